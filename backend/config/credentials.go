@@ -0,0 +1,27 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrCredentialsKeyMissing is returned when feed credentials have to be
+// encrypted or decrypted but FEED_CREDENTIALS_KEY is not set.
+var ErrCredentialsKeyMissing = errors.New("FEED_CREDENTIALS_KEY is not set")
+
+// CredentialsKey returns the AES-256 key feed credentials are encrypted
+// with, read from FEED_CREDENTIALS_KEY as 32 base64 encoded bytes.
+func CredentialsKey() ([]byte, error) {
+	value := strings.TrimSpace(os.Getenv("FEED_CREDENTIALS_KEY"))
+	if value == "" {
+		return nil, ErrCredentialsKeyMissing
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("FEED_CREDENTIALS_KEY must be 32 bytes encoded as base64")
+	}
+	return key, nil
+}
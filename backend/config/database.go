@@ -28,15 +28,122 @@ func ConnectDB() {
 
 	log.Println("Database connection established successfully!")
 
+	if err := dropGlobalArticleUniqueness(); err != nil {
+		log.Fatalf("Failed to migrate article uniqueness: %v", err)
+	}
+
 	err = DB.AutoMigrate(
 		&models.User{},
 		&models.Feed{},
 		&models.Subscription{},
 		&models.Article{},
+		&models.ArticleAuthor{},
+		&models.ArticleCategory{},
+		&models.ArticleEnclosure{},
+		&models.ArticleRevision{},
+		&models.StoryCluster{},
+		&models.FeedFetch{},
+		&models.FeedURLChange{},
+		&models.UserArticleState{},
+		&models.FeedIcon{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to auto-migrate database schema: %v", err)
 	}
 
+	if err := backfillArticleDedupKeys(); err != nil {
+		log.Fatalf("Failed to backfill article dedup keys: %v", err)
+	}
+
+	if err := backfillArticleAuthors(); err != nil {
+		log.Fatalf("Failed to backfill article authors: %v", err)
+	}
+
+	if err := createArticleSearchIndex(); err != nil {
+		log.Fatalf("Failed to create article search index: %v", err)
+	}
+
 	log.Println("Database migration completed successfully!")
-}
\ No newline at end of file
+}
+
+// dropGlobalArticleUniqueness removes the old unique constraints on
+// articles.link and articles.guid. Articles are deduplicated per feed now,
+// so two feeds may carry the same link or GUID. The constraint names cover
+// the ones created by older and newer GORM versions.
+func dropGlobalArticleUniqueness() error {
+	if !DB.Migrator().HasTable("articles") {
+		return nil
+	}
+
+	for _, name := range []string{"uni_articles_link", "uni_articles_guid", "articles_link_key", "articles_guid_key"} {
+		if err := DB.Exec(fmt.Sprintf("ALTER TABLE articles DROP CONSTRAINT IF EXISTS %s", name)).Error; err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"idx_articles_link", "idx_articles_guid"} {
+		if err := DB.Exec(fmt.Sprintf("DROP INDEX IF EXISTS %s", name)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillArticleDedupKeys fills the dedup key and canonical link of
+// articles stored before per-feed deduplication. Every such article has a
+// GUID, since the fetcher used to fall back to the link for missing GUIDs.
+func backfillArticleDedupKeys() error {
+	return DB.Exec(`UPDATE articles
+		SET dedup_key = 'guid:' || guid,
+			canonical_url = COALESCE(NULLIF(canonical_url, ''), link)
+		WHERE dedup_key IS NULL OR dedup_key = ''`).Error
+}
+
+// backfillArticleAuthors gives articles stored before authors had rows of
+// their own one author row holding their author field. The joined names
+// cannot be split reliably, the fetcher replaces the row with the separate
+// authors when the article changes.
+func backfillArticleAuthors() error {
+	return DB.Exec(`INSERT INTO article_authors (article_id, name, created_at, updated_at)
+		SELECT articles.id, left(articles.author, 255), NOW(), NOW()
+		FROM articles
+		WHERE articles.author <> '' AND articles.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM article_authors WHERE article_authors.article_id = articles.id)`).Error
+}
+
+// SearchLanguage is the Postgres text search configuration used to index and
+// query articles. Changing it requires dropping the search_vector column so
+// it is rebuilt.
+const SearchLanguage = "english"
+
+// createArticleSearchIndex adds the generated search_vector column to
+// articles and a GIN index over it. Titles weigh most, then descriptions,
+// then the body. The text is cut off well below the 1MB tsvector limit.
+func createArticleSearchIndex() error {
+	err := DB.Exec(fmt.Sprintf(`ALTER TABLE articles ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('%[1]s', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('%[1]s', left(coalesce(description_text, ''), 100000)), 'B') ||
+			setweight(to_tsvector('%[1]s', left(coalesce(content_text, '') || ' ' || coalesce(extracted_text, ''), 200000)), 'C')
+		) STORED`, SearchLanguage)).Error
+	if err != nil {
+		return err
+	}
+
+	return DB.Exec("CREATE INDEX IF NOT EXISTS idx_articles_search_vector ON articles USING GIN (search_vector)").Error
+}
+
+// CloseDB closes the database connection pool.
+func CloseDB() {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		log.Printf("Failed to get database connection pool: %v", err)
+		return
+	}
+
+	if err := sqlDB.Close(); err != nil {
+		log.Printf("Failed to close database connection pool: %v", err)
+		return
+	}
+
+	log.Println("Database connection closed.")
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -21,4 +22,39 @@ func GetEnv(key string) string {
 		log.Fatal("Environment variable " + key + " is not set")
 	}
 	return value
-}
\ No newline at end of file
+}
+
+// GetEnvOrDefault returns the value of key, or fallback when it is not set.
+func GetEnvOrDefault(key string, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// GetEnvInt returns the integer value of key, or fallback when it is not set.
+func GetEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatal("Environment variable " + key + " must be an integer")
+	}
+	return parsed
+}
+
+// GetEnvBool returns the boolean value of key, or fallback when it is not set.
+func GetEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatal("Environment variable " + key + " must be a boolean")
+	}
+	return parsed
+}
@@ -0,0 +1,47 @@
+package config
+
+import "time"
+
+// FetchConfig configures the HTTP client used to download feeds, article
+// pages and favicons.
+type FetchConfig struct {
+	// UserAgent is sent with every request.
+	UserAgent string
+	// ProxyURL routes all requests through an HTTP or HTTPS proxy. When
+	// empty the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables apply.
+	ProxyURL string
+	// ConnectTimeout bounds establishing the TCP connection and the TLS
+	// handshake.
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds a whole request, from sending it until the body has
+	// been read.
+	ReadTimeout time.Duration
+	// MaxBodyBytes is the largest response body accepted for a feed.
+	MaxBodyBytes int64
+	// TLSInsecureSkipVerify disables certificate verification. Only meant
+	// for testing against hosts with self-signed certificates.
+	TLSInsecureSkipVerify bool
+	// TLSMinVersion is the lowest TLS version accepted, "1.0" to "1.3".
+	TLSMinVersion string
+	// TLSCAFile is a PEM bundle of extra root certificates to trust.
+	TLSCAFile string
+	// AllowPrivateAddresses lets requests reach loopback, private and
+	// link-local addresses. Feed, article and icon URLs come from users and
+	// publishers, so they are refused by default.
+	AllowPrivateAddresses bool
+}
+
+// LoadFetchConfig reads the fetch client settings from the environment.
+func LoadFetchConfig() FetchConfig {
+	return FetchConfig{
+		UserAgent:             GetEnvOrDefault("FETCH_USER_AGENT", "Gofeed/1.0"),
+		ProxyURL:              GetEnvOrDefault("FETCH_PROXY_URL", ""),
+		ConnectTimeout:        time.Duration(GetEnvInt("FETCH_CONNECT_TIMEOUT_SECONDS", 10)) * time.Second,
+		ReadTimeout:           time.Duration(GetEnvInt("FETCH_READ_TIMEOUT_SECONDS", 30)) * time.Second,
+		MaxBodyBytes:          int64(GetEnvInt("FETCH_MAX_BODY_BYTES", 10<<20)),
+		TLSInsecureSkipVerify: GetEnvBool("FETCH_TLS_INSECURE_SKIP_VERIFY", false),
+		TLSMinVersion:         GetEnvOrDefault("FETCH_TLS_MIN_VERSION", "1.2"),
+		TLSCAFile:             GetEnvOrDefault("FETCH_TLS_CA_FILE", ""),
+		AllowPrivateAddresses: GetEnvBool("FETCH_ALLOW_PRIVATE_ADDRESSES", false),
+	}
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/FarrelioGustiana/backend/services"
 	"github.com/gin-gonic/gin"
@@ -29,18 +32,107 @@ func GetArticlesForUser(c *gin.Context) {
 		pageSize = 20
 	}
 
-	articles, total, err := services.GetArticlesForUser(userID.(string), page, pageSize)
+	feedIDs, err := parseIDList(c.Query("feedIds"))
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feedIds, expected a comma separated list of IDs"}) // 400 Bad Request
+		return
+	}
+	from, err := parseDateParam(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected RFC 3339 or YYYY-MM-DD"}) // 400 Bad Request
+		return
+	}
+	to, err := parseDateParam(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected RFC 3339 or YYYY-MM-DD"}) // 400 Bad Request
+		return
+	}
+
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order, expected asc or desc"}) // 400 Bad Request
+		return
+	}
+
+	opts := services.ArticleListOptions{
+		Page:            page,
+		PageSize:        pageSize,
+		CollapseStories: c.Query("collapse") == "true",
+		UnreadOnly:      c.Query("unread") == "true",
+		FeedIDs:         feedIDs,
+		Folder:          strings.TrimSpace(c.Query("folder")),
+		From:            from,
+		To:              to,
+		Author:          strings.TrimSpace(c.Query("author")),
+		Category:        strings.TrimSpace(c.Query("category")),
+		SortBy:          c.Query("sort"),
+		Ascending:       order == "asc",
+	}
+
+	// Passing cursor, even empty for the first page, switches to keyset
+	// pagination. Offset pages are counted unless count=false, cursor pages
+	// only when count=true.
+	cursor, cursorMode := c.GetQuery("cursor")
+	if cursorMode {
+		opts.SkipCount = c.Query("count") != "true"
+		getArticlesByCursor(c, userID.(string), opts, cursor)
+		return
+	}
+	opts.SkipCount = c.Query("count") == "false"
+
+	articles, total, err := services.GetArticlesForUser(userID.(string), opts)
+	if err != nil {
+		if err.Error() == "invalid sort field" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort, expected published, ingested or title"}) // 400 Bad Request
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve articles: " + err.Error()}) // 500 Internal Server Error
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"articles": articles,
-		"total":    total,
 		"page":     page,
 		"pageSize": pageSize,
-	})
+	}
+	if !opts.SkipCount {
+		response["total"] = total
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// getArticlesByCursor answers GetArticlesForUser in keyset pagination mode.
+func getArticlesByCursor(c *gin.Context, userID string, opts services.ArticleListOptions, cursor string) {
+	page, err := services.GetArticlesForUserByCursor(userID, opts, cursor)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) // 400 Bad Request
+			return
+		}
+		if err.Error() == "invalid sort field" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort, expected published, ingested or title"}) // 400 Bad Request
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve articles: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	response := gin.H{
+		"articles":    page.Articles,
+		"pageSize":    opts.PageSize,
+		"next_cursor": nil,
+		"prev_cursor": nil,
+	}
+	if page.NextCursor != "" {
+		response["next_cursor"] = page.NextCursor
+	}
+	if page.PrevCursor != "" {
+		response["prev_cursor"] = page.PrevCursor
+	}
+	if !opts.SkipCount {
+		response["total"] = page.Total
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func GetArticleByID(c *gin.Context) {
@@ -69,3 +161,306 @@ func GetArticleByID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, article) // 200 OK
 }
+
+func GetArticleRevisions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	articleIDStr := c.Param("id")
+	articleID, err := strconv.ParseUint(articleIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID format"}) // 400 Bad Request
+		return
+	}
+
+	revisions, err := services.GetArticleRevisions(uint(articleID), userID.(string))
+	if err != nil {
+		if err.Error() == "article not found or not subscribed" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()}) // 404 Not Found
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve article revisions: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions) // 200 OK
+}
+
+type ReadStateRequest struct {
+	ArticleIDs []uint `json:"articleIds" binding:"required,min=1,max=1000"`
+	Read       *bool  `json:"read" binding:"required"`
+}
+
+type MarkAllReadRequest struct {
+	// FeedID limits marking to one subscribed feed, all feeds when omitted.
+	FeedID *uint `json:"feedId"`
+	// Before marks articles published up to this time, now when omitted.
+	Before *time.Time `json:"before"`
+}
+
+// MarkArticleRead marks a single article as read.
+func MarkArticleRead(c *gin.Context) {
+	setArticleReadState(c, true)
+}
+
+// MarkArticleUnread marks a single article as unread.
+func MarkArticleUnread(c *gin.Context) {
+	setArticleReadState(c, false)
+}
+
+func setArticleReadState(c *gin.Context, read bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	articleIDStr := c.Param("id")
+	articleID, err := strconv.ParseUint(articleIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID format"}) // 400 Bad Request
+		return
+	}
+
+	if err := services.SetArticleReadState(userID.(string), uint(articleID), read); err != nil {
+		if err.Error() == "article not found or not subscribed" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()}) // 404 Not Found
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update read state: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	c.Status(http.StatusNoContent) // 204 No Content
+}
+
+// SetArticlesReadState marks several articles as read or unread at once.
+func SetArticlesReadState(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	var req ReadStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) // 400 Bad Request
+		return
+	}
+
+	updated, err := services.SetArticlesReadState(userID.(string), req.ArticleIDs, *req.Read)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update read state: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": updated}) // 200 OK
+}
+
+// MarkAllArticlesRead marks all articles up to a point in time as read,
+// overall or for one feed.
+func MarkAllArticlesRead(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	var req MarkAllReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) // 400 Bad Request
+		return
+	}
+
+	before := time.Now()
+	if req.Before != nil {
+		before = *req.Before
+	}
+
+	updated, err := services.MarkAllArticlesRead(userID.(string), req.FeedID, before)
+	if err != nil {
+		if err.Error() == "subscription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()}) // 404 Not Found
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark articles read: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": updated}) // 200 OK
+}
+
+// StarArticle saves an article to the user's starred list.
+func StarArticle(c *gin.Context) {
+	setArticleStarred(c, true)
+}
+
+// UnstarArticle removes an article from the user's starred list.
+func UnstarArticle(c *gin.Context) {
+	setArticleStarred(c, false)
+}
+
+func setArticleStarred(c *gin.Context, starred bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	articleIDStr := c.Param("id")
+	articleID, err := strconv.ParseUint(articleIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID format"}) // 400 Bad Request
+		return
+	}
+
+	if err := services.SetArticleStarred(userID.(string), uint(articleID), starred); err != nil {
+		if err.Error() == "article not found or not subscribed" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()}) // 404 Not Found
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update starred state: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	c.Status(http.StatusNoContent) // 204 No Content
+}
+
+// GetStarredArticles lists the articles the user starred, most recently
+// starred first.
+func GetStarredArticles(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+
+	articles, total, err := services.GetStarredArticles(userID.(string), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve starred articles: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"articles": articles,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// parseIDList parses a comma separated list of IDs such as "1,2,3".
+func parseIDList(value string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// parseDateParam parses an RFC 3339 timestamp or a plain date. A plain date
+// used as an upper bound covers the whole day.
+func parseDateParam(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return &parsed, nil
+	}
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		parsed = parsed.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &parsed, nil
+}
+
+// SearchArticles runs a full-text search over the user's articles.
+func SearchArticles(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter q is required"}) // 400 Bad Request
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+
+	feedIDs, err := parseIDList(c.Query("feedIds"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feedIds, expected a comma separated list of IDs"}) // 400 Bad Request
+		return
+	}
+	from, err := parseDateParam(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected RFC 3339 or YYYY-MM-DD"}) // 400 Bad Request
+		return
+	}
+	to, err := parseDateParam(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected RFC 3339 or YYYY-MM-DD"}) // 400 Bad Request
+		return
+	}
+
+	opts := services.ArticleSearchOptions{
+		Query:      query,
+		Page:       page,
+		PageSize:   pageSize,
+		FeedIDs:    feedIDs,
+		From:       from,
+		To:         to,
+		UnreadOnly: c.Query("unread") == "true",
+		ReadOnly:   c.Query("read") == "true",
+	}
+
+	results, total, err := services.SearchArticles(userID.(string), opts)
+	if err != nil {
+		if err.Error() == "search query is empty" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) // 400 Bad Request
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search articles: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":  results,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -9,8 +10,54 @@ import (
 )
 
 type FeedRequest struct {
-	Name string `json:"name" binding:"required"`
+	// Name is optional, the feed title is used when omitted.
+	Name string `json:"name"`
 	URL  string `json:"url" binding:"required,url"`
+	// FetchIntervalMinutes is optional, the default interval is used when omitted.
+	FetchIntervalMinutes int `json:"fetchIntervalMinutes" binding:"omitempty,min=5,max=1440"`
+	// FetchFullContent downloads every new article page and extracts its main text.
+	FetchFullContent bool `json:"fetchFullContent"`
+	// Headers are custom request headers sent when fetching the feed. They
+	// are write only like Auth: omit them to keep the stored headers, send {}
+	// to remove them.
+	Headers map[string]string `json:"headers"`
+	// Auth is write only, the secrets are never returned. Omit it to keep
+	// the stored credentials, send {"type": "none"} to remove them.
+	Auth *FeedAuthRequest `json:"auth"`
+}
+
+type FeedAuthRequest struct {
+	Type        string `json:"type" binding:"required,oneof=none basic bearer header"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Token       string `json:"token"`
+	HeaderName  string `json:"headerName"`
+	HeaderValue string `json:"headerValue"`
+}
+
+func (r *FeedAuthRequest) toInput() *services.FeedAuthInput {
+	if r == nil {
+		return nil
+	}
+	return &services.FeedAuthInput{
+		Type:        r.Type,
+		Username:    r.Username,
+		Password:    r.Password,
+		Token:       r.Token,
+		HeaderName:  r.HeaderName,
+		HeaderValue: r.HeaderValue,
+	}
+}
+
+func (r FeedRequest) toInput() services.FeedInput {
+	return services.FeedInput{
+		Name:                 r.Name,
+		URL:                  r.URL,
+		FetchIntervalMinutes: r.FetchIntervalMinutes,
+		FetchFullContent:     r.FetchFullContent,
+		Headers:              r.Headers,
+		Auth:                 r.Auth.toInput(),
+	}
 }
 
 func CreateFeed(c *gin.Context) {
@@ -24,7 +71,7 @@ func CreateFeed(c *gin.Context) {
 		return
 	}
 
-	feed, err := services.CreateFeed(request.Name, request.URL)
+	feed, err := services.CreateFeed(c.Request.Context(), request.toInput())
 	if err != nil {
 		if err.Error() == "feed with this URL already exists" {
 			c.JSON(http.StatusConflict, gin.H{
@@ -32,6 +79,10 @@ func CreateFeed(c *gin.Context) {
 			})
 			return
 		}
+		if status, ok := feedValidationStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create feed: " + err.Error(),
 		})
@@ -86,7 +137,7 @@ func UpdateFeed(c *gin.Context) {
 		return
 	}
 
-	feed, err := services.UpdateFeed(uint(id), req.Name, req.URL)
+	feed, err := services.UpdateFeed(c.Request.Context(), uint(id), req.toInput())
 	if err != nil {
 		if err.Error() == "feed not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()}) 
@@ -96,6 +147,10 @@ func UpdateFeed(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
+		if status, ok := feedValidationStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update feed: " + err.Error()}) 
 		return
 	}
@@ -123,4 +178,263 @@ func DeleteFeed(c *gin.Context) {
 	}
 
 	c.Status(http.StatusNoContent) 
-}
\ No newline at end of file
+}
+
+// GetUnhealthyFeeds lists feeds that are failing or have been disabled.
+func GetUnhealthyFeeds(c *gin.Context) {
+	feeds, err := services.GetUnhealthyFeeds()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve unhealthy feeds: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, feeds)
+}
+
+// EnableFeed re-enables a feed that was disabled after repeated failures.
+func EnableFeed(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID format"})
+		return
+	}
+
+	feed, err := services.EnableFeed(uint(id))
+	if err != nil {
+		if err.Error() == "feed not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable feed: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, feed)
+}
+
+// GetFeedFetches returns the fetch history of a feed, newest first.
+func GetFeedFetches(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID format"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	fetches, err := services.GetFeedFetches(uint(id), limit)
+	if err != nil {
+		if err.Error() == "feed not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve fetch history: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, fetches)
+}
+
+// GetFeedURLChanges lists the URL changes the fetcher made to a feed.
+func GetFeedURLChanges(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID format"})
+		return
+	}
+
+	changes, err := services.GetFeedURLChanges(uint(id))
+	if err != nil {
+		if err.Error() == "feed not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve URL history: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// GetFeedHeaders returns the custom request headers of a feed, which are
+// left out of the feed itself.
+func GetFeedHeaders(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID format"})
+		return
+	}
+
+	feed, err := services.GetFeedByID(uint(id))
+	if err != nil {
+		if err.Error() == "feed not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve feed: " + err.Error()})
+		return
+	}
+
+	headers := feed.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"headers": headers})
+}
+
+// GetFeedIcon serves the cached favicon of a feed. Icon URLs change with the
+// icon, so it can be cached for long.
+func GetFeedIcon(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("feedId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID format"})
+		return
+	}
+
+	icon, err := services.GetFeedIcon(uint(id))
+	if err != nil {
+		if err.Error() == "icon not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve icon: " + err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=604800")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, icon.ContentType, icon.Data)
+}
+
+// RefreshFeed fetches a single feed immediately and reports how many new
+// articles were stored.
+func RefreshFeed(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID format"})
+		return
+	}
+
+	newArticles, err := services.RefreshFeed(uint(id))
+	if err != nil {
+		if err.Error() == "feed not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrFeedFetchInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrFeedFetchFailed) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh feed: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"newArticles": newArticles})
+}
+
+// RefreshAllFeeds queues every enabled feed for fetching immediately. The
+// fetches run after the response, which only reports how many were queued.
+func RefreshAllFeeds(c *gin.Context) {
+	summary, err := services.RefreshAllFeeds()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh feeds: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, summary) // 202 Accepted
+}
+
+type DiscoverFeedsRequest struct {
+	URL string `json:"url" binding:"required,url"`
+}
+
+// DiscoverFeeds finds the feeds published by a website.
+func DiscoverFeeds(c *gin.Context) {
+	var req DiscoverFeedsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	feeds, err := services.DiscoverFeeds(c.Request.Context(), req.URL)
+	if err != nil {
+		if err.Error() == "invalid URL" || errors.Is(err, services.ErrPrivateAddress) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feeds": feeds})
+}
+
+// feedValidationStatus maps the errors of fetching and parsing a feed URL to
+// an HTTP status.
+func feedValidationStatus(err error) (int, bool) {
+	switch {
+	case err.Error() == "invalid URL", errors.Is(err, services.ErrInvalidFeedHeaders), errors.Is(err, services.ErrInvalidFeedAuth),
+		errors.Is(err, services.ErrPrivateAddress):
+		return http.StatusBadRequest, true
+	case errors.Is(err, services.ErrCredentialsKeyMissing):
+		return http.StatusServiceUnavailable, true
+	case errors.Is(err, services.ErrNotAFeed):
+		return http.StatusUnprocessableEntity, true
+	case errors.Is(err, services.ErrFeedUnreachable):
+		return http.StatusBadGateway, true
+	}
+	return 0, false
+}
+
+type PreviewFeedRequest struct {
+	URL     string            `json:"url" binding:"required,url"`
+	Headers map[string]string `json:"headers"`
+	Auth    *FeedAuthRequest  `json:"auth"`
+	// Limit is the number of items to return, 10 when omitted.
+	Limit int `json:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// PreviewFeed parses a feed and returns its first items without storing it.
+func PreviewFeed(c *gin.Context) {
+	var req PreviewFeedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = 10
+	}
+
+	preview, err := services.PreviewFeed(c.Request.Context(), services.FeedInput{
+		URL:     req.URL,
+		Headers: req.Headers,
+		Auth:    req.Auth.toInput(),
+	}, limit)
+	if err != nil {
+		if status, ok := feedValidationStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to preview feed: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
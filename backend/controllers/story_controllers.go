@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/FarrelioGustiana/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetStoriesForUser lists stories covered by several of the user's feeds,
+// most widely covered first.
+func GetStoriesForUser(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+	minSources, err := strconv.Atoi(c.DefaultQuery("minSources", "2"))
+	if err != nil || minSources < 1 {
+		minSources = 2
+	}
+
+	stories, total, err := services.GetStoriesForUser(userID.(string), page, pageSize, minSources)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve stories: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stories":  stories,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
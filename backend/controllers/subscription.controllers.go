@@ -9,7 +9,12 @@ import (
 )
 
 type SubscribeRequest struct {
-	FeedID uint `json:"feed_id" binding:"required"`
+	FeedID uint   `json:"feed_id" binding:"required"`
+	Folder string `json:"folder" binding:"max=255"`
+}
+
+type UpdateSubscriptionRequest struct {
+	Folder string `json:"folder" binding:"max=255"`
 }
 
 type SubscriptionResponse struct {
@@ -17,6 +22,8 @@ type SubscriptionResponse struct {
 	FeedID         uint   `json:"feed_id"`
 	FeedName       string `json:"feed_name"`
 	FeedURL        string `json:"feed_url"`
+	Folder         string `json:"folder"`
+	UnreadCount    int64  `json:"unread_count"`
 }
 
 func SubscribeToFeed(c *gin.Context) {
@@ -33,7 +40,7 @@ func SubscribeToFeed(c *gin.Context) {
 		return
 	}
 
-	subscription, err := services.SubscribeToFeed(userID.(string), uint(req.FeedID)) 
+	subscription, err := services.SubscribeToFeed(userID.(string), uint(req.FeedID), req.Folder) 
 	if err != nil {
 		if err.Error() == "user not found" || err.Error() == "feed not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()}) // 404 Not Found
@@ -57,7 +64,7 @@ func GetUserSubscriptions(c *gin.Context) {
 		return
 	}
 
-	subscriptions, err := services.GetUserSubscriptions(userID.(string))
+	subscriptions, err := services.GetUserSubscriptions(userID.(string), c.Query("collapse") == "true")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve subscriptions: " + err.Error()}) // 500 Internal Server Error
 		return
@@ -70,12 +77,47 @@ func GetUserSubscriptions(c *gin.Context) {
 			FeedID:         sub.Feed.ID,
 			FeedName:       sub.Feed.Name,
 			FeedURL:        sub.Feed.URL,
+			Folder:         sub.Folder,
+			UnreadCount:    sub.UnreadCount,
 		})
 	}
 
 	c.JSON(http.StatusOK, response) // 200 OK
 }
 
+// UpdateSubscription changes the folder of a subscription.
+func UpdateSubscription(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	feedID, err := strconv.ParseUint(c.Param("feedId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID format"}) // 400 Bad Request
+		return
+	}
+
+	var req UpdateSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) // 400 Bad Request
+		return
+	}
+
+	subscription, err := services.SetSubscriptionFolder(userID.(string), uint(feedID), req.Folder)
+	if err != nil {
+		if err.Error() == "subscription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()}) // 404 Not Found
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription: " + err.Error()}) // 500 Internal Server Error
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription) // 200 OK
+}
+
 func UnsubscribeFromFeed(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/FarrelioGustiana/backend/config"
+	"github.com/FarrelioGustiana/backend/controllers"
 	"github.com/FarrelioGustiana/backend/routes"
 	"github.com/FarrelioGustiana/backend/services"
 	"github.com/gin-gonic/gin"
@@ -15,7 +22,32 @@ func init() {
 	config.ConnectDB()
 }
 
-func main() {
+// Run modes of the binary. "serve" only runs the HTTP API, "worker" only runs
+// the feed scheduler and "all" runs both in one process.
+const (
+	modeServe  = "serve"
+	modeWorker = "worker"
+	modeAll    = "all"
+)
+
+// appMode returns the run mode from the first command line argument, falling
+// back to the APP_MODE environment variable and then to "all".
+func appMode() string {
+	mode := config.GetEnvOrDefault("APP_MODE", modeAll)
+	if len(os.Args) > 1 {
+		mode = os.Args[1]
+	}
+
+	switch mode {
+	case modeServe, modeWorker, modeAll:
+		return mode
+	default:
+		log.Fatalf("Unknown mode %q, expected one of: %s, %s, %s", mode, modeServe, modeWorker, modeAll)
+		return ""
+	}
+}
+
+func newRouter() *gin.Engine {
 	r := gin.Default()
 
 	r.Use(func(c *gin.Context) {
@@ -38,17 +70,93 @@ func main() {
 		})
 	})
 
+	// Cached feed favicons.
+	r.GET(services.IconRoutePrefix+"/:feedId", controllers.GetFeedIcon)
+
 	routes.SetupAPIRoutes(r)
 
-	services.StartFeedScheduler(config.DB)
+	return r
+}
+
+func main() {
+	mode := appMode()
+	log.Printf("Starting in %s mode.", mode)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var srv *http.Server
+	if mode != modeWorker {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+		srv = &http.Server{
+			Addr:    ":" + port,
+			Handler: newRouter(),
+		}
+
+		go func() {
+			log.Printf("Pilar Credo Backend Server starting on port %s...", port)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Server failed to start: %v", err)
+			}
+		}()
 	}
 
-	log.Printf("Pilar Credo Backend Server starting on port %s...", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// The scheduler only runs in the instance holding the scheduler lock, so
+	// several workers can be deployed without fetching feeds twice.
+	schedulerStarted := make(chan struct{})
+	var scheduler *services.FeedScheduler
+	var schedulerLock *services.SchedulerLock
+	if mode != modeServe {
+		go func() {
+			defer close(schedulerStarted)
+
+			retryInterval := time.Duration(config.GetEnvInt("SCHEDULER_LOCK_RETRY_SECONDS", 15)) * time.Second
+			lock, err := services.AcquireSchedulerLock(ctx, config.DB, retryInterval)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					log.Printf("Feed scheduler not started: %v", err)
+				}
+				return
+			}
+
+			schedulerLock = lock
+			scheduler = services.StartFeedScheduler(config.DB)
+		}()
+	} else {
+		close(schedulerStarted)
 	}
+
+	<-ctx.Done()
+
+	shutdownTimeout := time.Duration(config.GetEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30)) * time.Second
+	log.Printf("Shutting down, waiting up to %s for in-flight work...", shutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if srv != nil {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTP server shutdown error: %v", err)
+		}
+	}
+
+	<-schedulerStarted
+	if scheduler != nil {
+		if err := scheduler.Stop(shutdownCtx); err != nil {
+			log.Printf("Feed scheduler shutdown error: %v", err)
+		}
+	}
+	if err := services.ShutdownFeedFetcher(shutdownCtx); err != nil {
+		log.Printf("Feed fetcher shutdown error: %v", err)
+	}
+	if schedulerLock != nil {
+		schedulerLock.Release()
+	}
+
+	config.CloseDB()
+	log.Println("Server stopped.")
 }
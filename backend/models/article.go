@@ -12,14 +12,55 @@ type Article struct {
 	gorm.Model `json:"-"`
 	ID          uint           `gorm:"primaryKey" json:"id"` 
 
-	FeedID      uint           `gorm:"not null" json:"feedId"` 
+	FeedID      uint           `gorm:"not null;uniqueIndex:idx_articles_feed_dedup_key,priority:1" json:"feedId"` 
 	Feed        Feed           `gorm:"foreignKey:FeedID" json:"feed,omitempty"` 
 	
 	Title       string         `gorm:"not null;size:500" json:"title"` 
-	Link        string         `gorm:"unique;not null;size:1000" json:"link"` 
+	Link        string         `gorm:"not null;size:1000" json:"link"` 
 	Description string         `gorm:"type:text" json:"description"` 
 	PubDate     *time.Time     `json:"pubDate,omitempty"`
-	GUID        string         `gorm:"unique" json:"guid"`    
+	GUID        string         `json:"guid"`    
+
+	// CanonicalURL is Link with tracking parameters and fragments removed.
+	CanonicalURL string `gorm:"size:1000;index" json:"canonicalUrl,omitempty"`
+	// DedupKey identifies an item within its feed: the GUID when the feed
+	// provides one, otherwise the canonical link. It is only unique per feed.
+	DedupKey string `gorm:"size:1000;uniqueIndex:idx_articles_feed_dedup_key,priority:2" json:"-"`
+	// DuplicateOfID points to the first article from another feed with the
+	// same canonical link, so readers can show a story once.
+	DuplicateOfID *uint `gorm:"index" json:"duplicateOfId,omitempty"`
+	// ClusterID groups this article with articles from other feeds that
+	// cover the same story.
+	ClusterID *uint `gorm:"index" json:"clusterId,omitempty"`
+
+	// DescriptionText and ContentText are plain text versions of the
+	// sanitized Description and Content HTML.
+	DescriptionText string `gorm:"type:text" json:"descriptionText,omitempty"`
+	Content         string `gorm:"type:text" json:"content,omitempty"`
+	ContentText     string `gorm:"type:text" json:"contentText,omitempty"`
+	// Sanitized is set once the HTML fields went through the sanitizer.
+	Sanitized bool `gorm:"not null;default:false;index" json:"-"`
+
+	Author   string `gorm:"size:500" json:"author,omitempty"`
+	ImageURL string `gorm:"size:1000" json:"imageUrl,omitempty"`
+
+	// ExtractedContent and ExtractedText hold the main content of the
+	// article page, for feeds with FetchFullContent enabled.
+	ExtractedContent string     `gorm:"type:text" json:"extractedContent,omitempty"`
+	ExtractedText    string     `gorm:"type:text" json:"extractedText,omitempty"`
+	ExtractedAt      *time.Time `json:"extractedAt,omitempty"`
+
+	// ContentHash fingerprints the fields that are tracked for changes.
+	ContentHash string `gorm:"size:64" json:"-"`
+
+	// IsRead and IsStarred are the state of the article for the requesting
+	// user. They are not columns, services fill them in when listing articles.
+	IsRead    bool `gorm:"-" json:"isRead"`
+	IsStarred bool `gorm:"-" json:"isStarred"`
+
+	Authors    []ArticleAuthor    `gorm:"foreignKey:ArticleID" json:"authors,omitempty"`
+	Categories []ArticleCategory  `gorm:"foreignKey:ArticleID" json:"categories,omitempty"`
+	Enclosures []ArticleEnclosure `gorm:"foreignKey:ArticleID" json:"enclosures,omitempty"`
 
 	CreatedAt   time.Time      `json:"createdAt"`
 	UpdatedAt   time.Time      `json:"updatedAt"`
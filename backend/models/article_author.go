@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ArticleAuthor is one of the authors of an article. Article.Author joins
+// their names for display, but names may contain commas themselves, so
+// filtering by author goes through these rows.
+type ArticleAuthor struct {
+	gorm.Model `json:"-"`
+	ID         uint `gorm:"primaryKey" json:"id"`
+
+	ArticleID uint   `gorm:"not null;index" json:"articleId"`
+	Name      string `gorm:"not null;size:255;index" json:"name"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
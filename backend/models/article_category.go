@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ArticleCategory is a category or tag attached to an article by its feed.
+type ArticleCategory struct {
+	gorm.Model `json:"-"`
+	ID         uint `gorm:"primaryKey" json:"id"`
+
+	ArticleID uint   `gorm:"not null;index" json:"articleId"`
+	Name      string `gorm:"not null;size:255;index" json:"name"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
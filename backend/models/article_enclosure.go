@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ArticleEnclosure is a media file attached to an article, such as a podcast
+// episode or an image.
+type ArticleEnclosure struct {
+	gorm.Model `json:"-"`
+	ID         uint `gorm:"primaryKey" json:"id"`
+
+	ArticleID uint   `gorm:"not null;index" json:"articleId"`
+	URL       string `gorm:"not null;size:1000" json:"url"`
+	Type      string `gorm:"size:255" json:"type,omitempty"`
+	Length    int64  `json:"length,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
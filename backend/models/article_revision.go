@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ArticleRevision keeps the previous version of an article each time the
+// fetcher sees changed content for it.
+type ArticleRevision struct {
+	gorm.Model `json:"-"`
+	ID         uint `gorm:"primaryKey" json:"id"`
+
+	ArticleID uint `gorm:"not null;index" json:"articleId"`
+
+	Title       string `gorm:"size:500" json:"title"`
+	Description string `gorm:"type:text" json:"description"`
+	Content     string `gorm:"type:text" json:"content,omitempty"`
+	Author      string `gorm:"size:500" json:"author,omitempty"`
+	ImageURL    string `gorm:"size:1000" json:"imageUrl,omitempty"`
+	// Categories are the category names of the previous version.
+	Categories  []string `gorm:"serializer:json;type:text" json:"categories,omitempty"`
+	ContentHash string   `gorm:"size:64" json:"-"`
+	// ChangedFields lists the fields that differ in the replacing version,
+	// comma separated.
+	ChangedFields string `gorm:"size:255" json:"changedFields"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
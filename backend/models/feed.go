@@ -12,6 +12,60 @@ type Feed struct {
 	Name          string         `gorm:"not null" json:"name"`
 	URL           string         `gorm:"unique;not null" json:"url"`
 	LastFetchedAt *time.Time     `json:"lastFetchedAt,omitempty"`
+	ETag          string         `json:"-"`
+	LastModified  string         `json:"-"`
+
+	// Metadata published by the feed itself, refreshed on every fetch.
+	Title         string     `json:"title"`
+	Description   string     `gorm:"type:text" json:"description"`
+	SiteURL       string     `gorm:"size:1000" json:"siteUrl"`
+	Language      string     `json:"language"`
+	ImageURL      string     `gorm:"size:1000" json:"imageUrl"`
+	FeedUpdatedAt *time.Time `json:"feedUpdatedAt,omitempty"`
+
+	// IconURL is the path the cached site favicon is served from, under
+	// /icons. IconSourceURL is where it was downloaded from.
+	IconURL       string     `json:"iconUrl"`
+	IconSourceURL string     `gorm:"size:1000" json:"-"`
+	IconFetchedAt *time.Time `json:"-"`
+
+	FetchIntervalMinutes    int        `gorm:"not null;default:15" json:"fetchIntervalMinutes"`
+	AdaptiveIntervalMinutes int        `json:"adaptiveIntervalMinutes"`
+	NextFetchAt             *time.Time `gorm:"index" json:"nextFetchAt,omitempty"`
+
+	// Headers are sent with every request for this feed. They are stored in
+	// plain text, secrets belong in the credentials. They may still be
+	// sensitive, so only admins get to see them, see GetFeedHeaders.
+	Headers map[string]string `gorm:"serializer:json;type:text" json:"-"`
+
+	// AuthType is one of the FeedAuth* schemes. AuthHeaderName names the
+	// header carrying the secret of the "header" scheme, such as X-API-Key.
+	// The secrets themselves are stored encrypted and never serialized.
+	AuthType             string `json:"authType,omitempty"`
+	AuthHeaderName       string `json:"authHeaderName,omitempty"`
+	EncryptedCredentials string `gorm:"type:text" json:"-"`
+
+	// FetchFullContent makes the fetcher download each new article page and
+	// extract its main content, for feeds that only publish teasers.
+	FetchFullContent bool `gorm:"not null;default:false" json:"fetchFullContent"`
+
+	LastSuccessAt       *time.Time `json:"lastSuccessAt,omitempty"`
+	LastError           string     `gorm:"type:text" json:"lastError,omitempty"`
+	LastHTTPStatus      int        `json:"lastHttpStatus,omitempty"`
+	ConsecutiveFailures int        `gorm:"not null;default:0" json:"consecutiveFailures"`
+	Disabled            bool       `gorm:"not null;default:false;index" json:"disabled"`
+	DisabledAt          *time.Time `json:"disabledAt,omitempty"`
+	// DisabledReason tells why the fetcher disabled the feed: "failures" after
+	// too many consecutive errors or "gone" when the publisher answered 410.
+	DisabledReason string `json:"disabledReason,omitempty"`
+
+	// RedirectURL is the target of the permanent redirects seen on the last
+	// fetches and RedirectCount how many fetches in a row were redirected
+	// there. The feed moves to RedirectURL once the count reaches the
+	// configured threshold.
+	RedirectURL   string `gorm:"size:1000" json:"redirectUrl,omitempty"`
+	RedirectCount int    `gorm:"not null;default:0" json:"redirectCount"`
+
 	CreatedAt     time.Time      `json:"createdAt"`
 	UpdatedAt     time.Time      `json:"updatedAt"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"` 
@@ -0,0 +1,18 @@
+package models
+
+// Authentication schemes of a feed.
+const (
+	FeedAuthNone   = ""
+	FeedAuthBasic  = "basic"
+	FeedAuthBearer = "bearer"
+	FeedAuthHeader = "header"
+)
+
+// FeedCredentials are the secrets used to fetch a private feed. They are
+// only ever stored encrypted, in Feed.EncryptedCredentials.
+type FeedCredentials struct {
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	Token       string `json:"token,omitempty"`
+	HeaderValue string `json:"headerValue,omitempty"`
+}
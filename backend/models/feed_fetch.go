@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FeedFetch records a single attempt of the scheduler to fetch a feed.
+type FeedFetch struct {
+	gorm.Model `json:"-"`
+	ID         uint `gorm:"primaryKey" json:"id"`
+
+	FeedID uint `gorm:"not null;index" json:"feedId"`
+
+	StartedAt        time.Time `gorm:"not null;index" json:"startedAt"`
+	FinishedAt       time.Time `json:"finishedAt"`
+	HTTPStatus       int       `json:"httpStatus,omitempty"`
+	BytesDownloaded  int64     `json:"bytesDownloaded"`
+	ItemsSeen        int       `json:"itemsSeen"`
+	ArticlesInserted int       `json:"articlesInserted"`
+	ArticlesUpdated  int       `json:"articlesUpdated"`
+	Error            string    `gorm:"type:text" json:"error,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FeedIcon is the cached favicon of the site of a feed. Icons live in the
+// database rather than on disk so that every API instance can serve them,
+// whichever instance fetched them.
+type FeedIcon struct {
+	gorm.Model `json:"-"`
+	ID         uint `gorm:"primaryKey" json:"id"`
+
+	FeedID      uint   `gorm:"not null;uniqueIndex" json:"feedId"`
+	ContentType string `gorm:"not null" json:"contentType"`
+	Data        []byte `gorm:"not null" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
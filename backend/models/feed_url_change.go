@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FeedURLChange records a change of the URL of a feed made by the fetcher,
+// for example after the publisher moved the feed with permanent redirects.
+type FeedURLChange struct {
+	gorm.Model `json:"-"`
+	ID         uint `gorm:"primaryKey" json:"id"`
+
+	FeedID uint   `gorm:"not null;index" json:"feedId"`
+	OldURL string `gorm:"not null;size:1000" json:"oldUrl"`
+	NewURL string `gorm:"not null;size:1000" json:"newUrl"`
+	Reason string `gorm:"not null" json:"reason"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StoryCluster groups articles from different feeds that report the same story.
+type StoryCluster struct {
+	gorm.Model `json:"-"`
+	ID         uint `gorm:"primaryKey" json:"id"`
+
+	// Title is the title of the first article of the cluster.
+	Title        string     `gorm:"not null;size:500" json:"title"`
+	ArticleCount int        `gorm:"not null;default:0" json:"articleCount"`
+	SourceCount  int        `gorm:"not null;default:0;index" json:"sourceCount"`
+	FirstSeenAt  *time.Time `json:"firstSeenAt,omitempty"`
+	LastSeenAt   *time.Time `gorm:"index" json:"lastSeenAt,omitempty"`
+
+	Articles []Article `gorm:"foreignKey:ClusterID" json:"articles,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
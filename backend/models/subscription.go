@@ -17,5 +17,12 @@ type Subscription struct {
 	Feed Feed `gorm:"foreignKey:FeedID" json:"feed,omitempty"`
 
 	SubscribedAt time.Time `json:"subscribedAt"`
+
+	// Folder groups subscriptions for the subscriber, empty when unfiled.
+	Folder string `gorm:"size:255;index" json:"folder"`
+
+	// UnreadCount is the number of unread articles of the feed for the
+	// subscriber. It is not a column.
+	UnreadCount int64 `gorm:"-" json:"unreadCount"`
 }
 
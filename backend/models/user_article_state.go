@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserArticleState holds what a user did with an article. Articles without a
+// state row are unread.
+type UserArticleState struct {
+	gorm.Model `json:"-"`
+	ID         uint `gorm:"primaryKey" json:"id"`
+
+	UserID    string `gorm:"type:uuid;not null;uniqueIndex:idx_user_article_states_user_article,priority:1" json:"userId"`
+	ArticleID uint   `gorm:"not null;uniqueIndex:idx_user_article_states_user_article,priority:2;index" json:"articleId"`
+
+	IsRead bool       `gorm:"not null;default:false" json:"isRead"`
+	ReadAt *time.Time `json:"readAt,omitempty"`
+
+	// IsStarred keeps the article in the user's saved list. Starred articles
+	// stay readable after unsubscribing and must never be pruned.
+	IsStarred bool       `gorm:"not null;default:false;index" json:"isStarred"`
+	StarredAt *time.Time `json:"starredAt,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
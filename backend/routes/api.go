@@ -26,24 +26,46 @@ func SetupAPIRoutes(router *gin.Engine) {
 		// Feeds - GET endpoints available to all authenticated users
 		apiRoutes.GET("/feeds", controllers.GetAllFeeds)
 		apiRoutes.GET("/feeds/:id", controllers.GetFeedByID)
+		apiRoutes.POST("/feeds/discover", controllers.DiscoverFeeds)
 		
 		// Admin - POST, PUT, DELETE endpoints available only to admin users
 		adminRoutes := apiRoutes.Group("")
 		adminRoutes.Use(middleware.AdminMiddleware())
 		{
 			adminRoutes.POST("/feeds", controllers.CreateFeed)
+			adminRoutes.POST("/feeds/preview", controllers.PreviewFeed)
 			adminRoutes.PUT("/feeds/:id", controllers.UpdateFeed)
 			adminRoutes.DELETE("/feeds/:id", controllers.DeleteFeed)
+			adminRoutes.GET("/feeds/unhealthy", controllers.GetUnhealthyFeeds)
+			adminRoutes.POST("/feeds/:id/enable", controllers.EnableFeed)
+			adminRoutes.GET("/feeds/:id/fetches", controllers.GetFeedFetches)
+			adminRoutes.GET("/feeds/:id/url-changes", controllers.GetFeedURLChanges)
+			adminRoutes.GET("/feeds/:id/headers", controllers.GetFeedHeaders)
+			adminRoutes.POST("/feeds/refresh", controllers.RefreshAllFeeds)
+			adminRoutes.POST("/feeds/:id/refresh", controllers.RefreshFeed)
 		}
 
 		// Subcriptions
 		apiRoutes.POST("/subscriptions", controllers.SubscribeToFeed) 
 		apiRoutes.GET("/subscriptions", controllers.GetUserSubscriptions)
+		apiRoutes.PUT("/subscriptions/:feedId", controllers.UpdateSubscription)
 		apiRoutes.DELETE("/subscriptions/:feedId", controllers.UnsubscribeFromFeed) 
 		apiRoutes.GET("/subscriptions/:feedId/status", controllers.CheckSubscriptionStatus)
 
 		// Articles
 		apiRoutes.GET("/articles", controllers.GetArticlesForUser)
+		apiRoutes.GET("/articles/starred", controllers.GetStarredArticles)
+		apiRoutes.GET("/articles/search", controllers.SearchArticles)
 		apiRoutes.GET("/articles/:id", controllers.GetArticleByID)
+		apiRoutes.GET("/articles/:id/revisions", controllers.GetArticleRevisions)
+		apiRoutes.POST("/articles/:id/read", controllers.MarkArticleRead)
+		apiRoutes.POST("/articles/:id/unread", controllers.MarkArticleUnread)
+		apiRoutes.POST("/articles/:id/star", controllers.StarArticle)
+		apiRoutes.POST("/articles/:id/unstar", controllers.UnstarArticle)
+		apiRoutes.POST("/articles/read-state", controllers.SetArticlesReadState)
+		apiRoutes.POST("/articles/read-all", controllers.MarkAllArticlesRead)
+
+		// Stories
+		apiRoutes.GET("/stories", controllers.GetStoriesForUser)
 	}
 }
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+// ErrInvalidCursor is returned for cursors that cannot be decoded or were
+// made for another sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ArticleCursorPage is a page of articles fetched with keyset pagination.
+// NextCursor and PrevCursor are empty when there is nothing further in that
+// direction. Total is only set when counting was asked for.
+type ArticleCursorPage struct {
+	Articles   []models.Article
+	Total      int64
+	NextCursor string
+	PrevCursor string
+}
+
+// articleCursor is the position of an article in a sorted list. It is sent to
+// clients as opaque base64 encoded JSON.
+type articleCursor struct {
+	Sort      string `json:"s"`
+	Ascending bool   `json:"a,omitempty"`
+	// Value is the sort column of the article, nil when it has none.
+	Value *string `json:"v,omitempty"`
+	ID    uint    `json:"i"`
+	// Before asks for the page preceding the article instead of the one
+	// following it.
+	Before bool `json:"b,omitempty"`
+}
+
+// sortKey normalizes the sort key of ArticleListOptions.
+func sortKey(sortBy string) string {
+	if sortBy == "" {
+		return "published"
+	}
+	return sortBy
+}
+
+// newArticleCursor returns the encoded cursor pointing at article.
+func newArticleCursor(article models.Article, opts ArticleListOptions, before bool) string {
+	cursor := articleCursor{
+		Sort:      sortKey(opts.SortBy),
+		Ascending: opts.Ascending,
+		ID:        article.ID,
+		Before:    before,
+	}
+
+	var value string
+	switch cursor.Sort {
+	case "published":
+		if article.PubDate != nil {
+			value = article.PubDate.UTC().Format(time.RFC3339Nano)
+			cursor.Value = &value
+		}
+	case "ingested":
+		value = article.CreatedAt.UTC().Format(time.RFC3339Nano)
+		cursor.Value = &value
+	case "title":
+		value = article.Title
+		cursor.Value = &value
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeArticleCursor decodes a cursor and checks it matches the sort order of
+// opts.
+func decodeArticleCursor(encoded string, opts ArticleListOptions) (*articleCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor articleCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sortKey(opts.SortBy) || cursor.Ascending != opts.Ascending {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// where narrows query on column to the articles past the cursor, in list
+// order or, for Before cursors, in reverse. Articles without a value sort
+// last, see articleOrder.
+func (c *articleCursor) where(query *gorm.DB, column string) (*gorm.DB, error) {
+	cmp := "<"
+	if c.Ascending != c.Before {
+		cmp = ">"
+	}
+
+	if c.Value == nil {
+		if c.Before {
+			return query.Where(fmt.Sprintf("(%[1]s IS NOT NULL OR articles.id %[2]s ?)", column, cmp), c.ID), nil
+		}
+		return query.Where(fmt.Sprintf("(%[1]s IS NULL AND articles.id %[2]s ?)", column, cmp), c.ID), nil
+	}
+
+	var value interface{} = *c.Value
+	if c.Sort != "title" {
+		parsed, err := time.Parse(time.RFC3339Nano, *c.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		value = parsed
+	}
+
+	condition := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND articles.id %[2]s ?))", column, cmp)
+	if !c.Before {
+		condition = fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND articles.id %[2]s ?) OR %[1]s IS NULL)", column, cmp)
+	}
+	return query.Where(condition, value, value, c.ID), nil
+}
+
+// GetArticlesForUserByCursor returns the articles GetArticlesForUser would
+// list, paged on the sort column and the article ID instead of an offset.
+// An empty cursor starts at the top of the list. Unlike offsets, cursors do
+// not skip or repeat articles when new ones arrive between pages.
+func GetArticlesForUserByCursor(userID string, opts ArticleListOptions, encodedCursor string) (*ArticleCursorPage, error) {
+	sortColumn, ok := articleSortColumns[opts.SortBy]
+	if !ok {
+		return nil, errors.New("invalid sort field")
+	}
+
+	var cursor *articleCursor
+	if encodedCursor != "" {
+		var err error
+		if cursor, err = decodeArticleCursor(encodedCursor, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	query, err := articleListQuery(userID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if query == nil {
+		return &ArticleCursorPage{Articles: []models.Article{}}, nil
+	}
+
+	page := &ArticleCursorPage{}
+	if !opts.SkipCount {
+		if err := query.Count(&page.Total).Error; err != nil {
+			return nil, fmt.Errorf("failed to count articles for user: %w", err)
+		}
+	}
+
+	before := cursor != nil && cursor.Before
+	pageQuery := query
+	if cursor != nil {
+		if pageQuery, err = cursor.where(query, sortColumn); err != nil {
+			return nil, err
+		}
+	}
+
+	// One extra article tells whether there is another page.
+	var articles []models.Article
+	result := pageQuery.Preload("Feed").
+		Order(articleOrder(sortColumn, opts.Ascending, before)).
+		Limit(opts.PageSize + 1).
+		Find(&articles)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve articles for user: %w", result.Error)
+	}
+
+	more := len(articles) > opts.PageSize
+	if more {
+		articles = articles[:opts.PageSize]
+	}
+	if before {
+		for i, j := 0, len(articles)-1; i < j; i, j = i+1, j-1 {
+			articles[i], articles[j] = articles[j], articles[i]
+		}
+	}
+
+	if err := fillArticleStates(userID, articles); err != nil {
+		return nil, err
+	}
+	page.Articles = articles
+
+	if len(articles) == 0 {
+		return page, nil
+	}
+	first, last := articles[0], articles[len(articles)-1]
+	if before {
+		page.NextCursor = newArticleCursor(last, opts, false)
+		if more {
+			page.PrevCursor = newArticleCursor(first, opts, true)
+		}
+	} else {
+		if more {
+			page.NextCursor = newArticleCursor(last, opts, false)
+		}
+		if cursor != nil {
+			page.PrevCursor = newArticleCursor(first, opts, true)
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+// encodeCursor encodes raw JSON the way cursors are sent to clients.
+func encodeCursor(raw string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func TestArticleCursorRoundTrip(t *testing.T) {
+	published := time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.FixedZone("WIB", 7*60*60))
+	ingested := time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC)
+
+	article := models.Article{Title: "Budget approved", PubDate: &published}
+	article.ID = 42
+	article.CreatedAt = ingested
+	undated := models.Article{Title: "Undated"}
+	undated.ID = 43
+
+	tests := []struct {
+		name      string
+		article   models.Article
+		opts      ArticleListOptions
+		before    bool
+		wantValue *string
+	}{
+		{
+			name:      "default sort",
+			article:   article,
+			opts:      ArticleListOptions{},
+			wantValue: strPtr("2024-03-01T05:30:00.123456789Z"),
+		},
+		{
+			name:      "published ascending, before",
+			article:   article,
+			opts:      ArticleListOptions{SortBy: "published", Ascending: true},
+			before:    true,
+			wantValue: strPtr("2024-03-01T05:30:00.123456789Z"),
+		},
+		{
+			name:      "ingested",
+			article:   article,
+			opts:      ArticleListOptions{SortBy: "ingested"},
+			wantValue: strPtr("2024-03-02T08:00:00Z"),
+		},
+		{
+			name:      "title",
+			article:   article,
+			opts:      ArticleListOptions{SortBy: "title", Ascending: true},
+			wantValue: strPtr("Budget approved"),
+		},
+		{
+			name:    "article without publication date",
+			article: undated,
+			opts:    ArticleListOptions{SortBy: "published"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := newArticleCursor(tt.article, tt.opts, tt.before)
+			cursor, err := decodeArticleCursor(encoded, tt.opts)
+			if err != nil {
+				t.Fatalf("decodeArticleCursor(%q): %v", encoded, err)
+			}
+
+			if cursor.ID != tt.article.ID {
+				t.Errorf("ID = %d, want %d", cursor.ID, tt.article.ID)
+			}
+			if cursor.Before != tt.before {
+				t.Errorf("Before = %v, want %v", cursor.Before, tt.before)
+			}
+			if cursor.Sort != sortKey(tt.opts.SortBy) || cursor.Ascending != tt.opts.Ascending {
+				t.Errorf("sort = %q ascending %v, want %q ascending %v", cursor.Sort, cursor.Ascending, sortKey(tt.opts.SortBy), tt.opts.Ascending)
+			}
+			switch {
+			case tt.wantValue == nil && cursor.Value != nil:
+				t.Errorf("Value = %q, want none", *cursor.Value)
+			case tt.wantValue != nil && cursor.Value == nil:
+				t.Errorf("Value missing, want %q", *tt.wantValue)
+			case tt.wantValue != nil && *cursor.Value != *tt.wantValue:
+				t.Errorf("Value = %q, want %q", *cursor.Value, *tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestDecodeArticleCursorRejectsInvalidCursors(t *testing.T) {
+	published := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	article := models.Article{PubDate: &published}
+	article.ID = 42
+	valid := newArticleCursor(article, ArticleListOptions{SortBy: "published"}, false)
+
+	tests := []struct {
+		name    string
+		encoded string
+		opts    ArticleListOptions
+	}{
+		{name: "not base64", encoded: "!!not-a-cursor!!", opts: ArticleListOptions{}},
+		{name: "not JSON", encoded: encodeCursor("published:42"), opts: ArticleListOptions{}},
+		{name: "wrong field types", encoded: encodeCursor(`{"s":"published","i":"42"}`), opts: ArticleListOptions{}},
+		{name: "missing ID", encoded: encodeCursor(`{"s":"published"}`), opts: ArticleListOptions{}},
+		{name: "zero ID", encoded: encodeCursor(`{"s":"published","i":0}`), opts: ArticleListOptions{}},
+		{name: "negative ID", encoded: encodeCursor(`{"s":"published","i":-1}`), opts: ArticleListOptions{}},
+		{name: "other sort", encoded: valid, opts: ArticleListOptions{SortBy: "title"}},
+		{name: "other direction", encoded: valid, opts: ArticleListOptions{SortBy: "published", Ascending: true}},
+		{name: "unknown sort", encoded: encodeCursor(`{"s":"popularity","i":42}`), opts: ArticleListOptions{}},
+		{name: "truncated", encoded: valid[:len(valid)-4], opts: ArticleListOptions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := decodeArticleCursor(tt.encoded, tt.opts)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("decodeArticleCursor(%q) = %+v, %v, want ErrInvalidCursor", tt.encoded, cursor, err)
+			}
+		})
+	}
+}
+
+func TestArticleOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		ascending bool
+		reverse   bool
+		want      string
+	}{
+		{name: "descending", want: "articles.pub_date DESC NULLS LAST, articles.id DESC"},
+		{name: "ascending", ascending: true, want: "articles.pub_date ASC NULLS LAST, articles.id ASC"},
+		{name: "descending reversed", reverse: true, want: "articles.pub_date ASC NULLS FIRST, articles.id ASC"},
+		{name: "ascending reversed", ascending: true, reverse: true, want: "articles.pub_date DESC NULLS FIRST, articles.id DESC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := articleOrder("articles.pub_date", tt.ascending, tt.reverse); got != tt.want {
+				t.Errorf("articleOrder() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArticleCursorWhere(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to open dry run database: %v", err)
+	}
+
+	published := "2024-03-01T05:30:00Z"
+	title := "Budget"
+
+	tests := []struct {
+		name    string
+		cursor  articleCursor
+		column  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "next page, descending",
+			cursor: articleCursor{Sort: "published", Value: &published, ID: 10},
+			column: "articles.pub_date",
+			want:   "(articles.pub_date < '2024-03-01 05:30:00' OR (articles.pub_date = '2024-03-01 05:30:00' AND articles.id < 10) OR articles.pub_date IS NULL)",
+		},
+		{
+			name:   "next page, ascending",
+			cursor: articleCursor{Sort: "title", Ascending: true, Value: &title, ID: 10},
+			column: "articles.title",
+			want:   "(articles.title > 'Budget' OR (articles.title = 'Budget' AND articles.id > 10) OR articles.title IS NULL)",
+		},
+		{
+			name:   "previous page, descending",
+			cursor: articleCursor{Sort: "published", Value: &published, ID: 10, Before: true},
+			column: "articles.pub_date",
+			want:   "(articles.pub_date > '2024-03-01 05:30:00' OR (articles.pub_date = '2024-03-01 05:30:00' AND articles.id > 10))",
+		},
+		{
+			name:   "previous page, ascending",
+			cursor: articleCursor{Sort: "title", Ascending: true, Value: &title, ID: 10, Before: true},
+			column: "articles.title",
+			want:   "(articles.title < 'Budget' OR (articles.title = 'Budget' AND articles.id < 10))",
+		},
+		{
+			name:   "next page after an article without value",
+			cursor: articleCursor{Sort: "published", ID: 10},
+			column: "articles.pub_date",
+			want:   "(articles.pub_date IS NULL AND articles.id < 10)",
+		},
+		{
+			name:   "previous page before an article without value",
+			cursor: articleCursor{Sort: "published", ID: 10, Before: true},
+			column: "articles.pub_date",
+			want:   "(articles.pub_date IS NOT NULL OR articles.id > 10)",
+		},
+		{
+			name:   "previous page before an article without value, ascending",
+			cursor: articleCursor{Sort: "published", Ascending: true, ID: 10, Before: true},
+			column: "articles.pub_date",
+			want:   "(articles.pub_date IS NOT NULL OR articles.id < 10)",
+		},
+		{
+			name:    "tampered date",
+			cursor:  articleCursor{Sort: "published", Value: &title, ID: 10},
+			column:  "articles.pub_date",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var whereErr error
+			sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				query, err := tt.cursor.where(tx.Model(&models.Article{}), tt.column)
+				if err != nil {
+					whereErr = err
+					return tx.Model(&models.Article{}).Find(&[]models.Article{})
+				}
+				return query.Find(&[]models.Article{})
+			})
+
+			if tt.wantErr {
+				if !errors.Is(whereErr, ErrInvalidCursor) {
+					t.Fatalf("where() error = %v, want ErrInvalidCursor", whereErr)
+				}
+				return
+			}
+			if whereErr != nil {
+				t.Fatalf("where() error = %v", whereErr)
+			}
+			if !strings.Contains(sql, tt.want) {
+				t.Errorf("query is missing %s:\n%s", tt.want, sql)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
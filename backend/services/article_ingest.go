@@ -0,0 +1,422 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+
+	"github.com/FarrelioGustiana/backend/models"
+	"github.com/FarrelioGustiana/backend/utils"
+)
+
+// buildArticle maps a parsed feed item to an article of feed. The returned
+// article has an empty DedupKey when the item has neither a link nor a GUID.
+func buildArticle(feed *models.Feed, item *gofeed.Item) models.Article {
+	link := strings.TrimSpace(item.Link)
+	guid := strings.TrimSpace(item.GUID)
+	canonicalURL := utils.CanonicalizeURL(link)
+
+	pubDate := time.Now()
+	if item.PublishedParsed != nil {
+		pubDate = *item.PublishedParsed
+	}
+
+	// Feed HTML is untrusted and rendered by the frontend, so it is
+	// sanitized before it is stored.
+	description := utils.SanitizeHTML(item.Description)
+	content := utils.SanitizeHTML(item.Content)
+
+	article := models.Article{
+		FeedID:          feed.ID,
+		Title:           truncate(utils.HTMLToText(item.Title), 500),
+		Link:            truncate(link, 1000),
+		Description:     description,
+		DescriptionText: utils.HTMLToText(description),
+		PubDate:         &pubDate,
+		GUID:            guid,
+		CanonicalURL:    truncate(canonicalURL, 1000),
+		DedupKey:        articleDedupKey(guid, canonicalURL),
+		Content:         content,
+		ContentText:     utils.HTMLToText(content),
+		Sanitized:       true,
+		ImageURL:        itemImageURL(item),
+	}
+
+	names := itemAuthors(item)
+	for _, name := range names {
+		article.Authors = append(article.Authors, models.ArticleAuthor{Name: truncate(name, 255)})
+	}
+	article.Author = truncate(strings.Join(names, ", "), 500)
+
+	seen := make(map[string]bool)
+	for _, name := range item.Categories {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		article.Categories = append(article.Categories, models.ArticleCategory{Name: truncate(name, 255)})
+	}
+
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil || enclosure.URL == "" {
+			continue
+		}
+		length, _ := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+		article.Enclosures = append(article.Enclosures, models.ArticleEnclosure{
+			URL:    truncate(enclosure.URL, 1000),
+			Type:   truncate(enclosure.Type, 255),
+			Length: length,
+		})
+	}
+
+	article.ContentHash = articleContentHash(&article)
+
+	return article
+}
+
+// articleDedupKey identifies an item within its feed. GUIDs win over links
+// because publishers change links more often than GUIDs. The prefix keeps a
+// GUID that happens to look like a URL apart from a link.
+func articleDedupKey(guid string, canonicalURL string) string {
+	switch {
+	case guid != "":
+		return truncate("guid:"+guid, 1000)
+	case canonicalURL != "":
+		return truncate("url:"+canonicalURL, 1000)
+	default:
+		return ""
+	}
+}
+
+// findExistingArticle looks up the stored version of article within its own
+// feed by dedup key. Items of one feed may share a link while each has its
+// own GUID, so the canonical link is only a fallback for the changes of
+// identity a feed can go through: an item that lost its GUID, or a stored
+// article keyed by link whose item gained a GUID. The latter adopts the GUID
+// key, so other items with the same link are not matched to it later.
+func findExistingArticle(db *gorm.DB, article *models.Article) (*models.Article, error) {
+	var existing models.Article
+	err := db.Where("feed_id = ? AND dedup_key = ?", article.FeedID, article.DedupKey).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) || article.CanonicalURL == "" {
+		return nil, err
+	}
+
+	query := db.Where("feed_id = ? AND canonical_url = ?", article.FeedID, article.CanonicalURL)
+	if article.GUID != "" {
+		query = query.Where("dedup_key LIKE ?", "url:%")
+	}
+	if err := query.Order("id ASC").First(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	if article.GUID != "" {
+		err := db.Model(&existing).Updates(map[string]interface{}{
+			"dedup_key": article.DedupKey,
+			"guid":      article.GUID,
+		}).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to update dedup key: %w", err)
+		}
+	}
+	return &existing, nil
+}
+
+// linkDuplicateStory points article at the first article of another feed with
+// the same canonical link, if there is one.
+func linkDuplicateStory(db *gorm.DB, article *models.Article) error {
+	if article.CanonicalURL == "" {
+		return nil
+	}
+
+	var original models.Article
+	err := db.Select("id").
+		Where("canonical_url = ? AND feed_id <> ? AND duplicate_of_id IS NULL", article.CanonicalURL, article.FeedID).
+		Order("id ASC").
+		First(&original).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	article.DuplicateOfID = &original.ID
+	return nil
+}
+
+// articleContentHash fingerprints the parts of an article that publishers
+// correct after the fact: title, summary, body, author, image and categories.
+func articleContentHash(article *models.Article) string {
+	categories := make([]string, 0, len(article.Categories))
+	for _, category := range article.Categories {
+		categories = append(categories, strings.ToLower(category.Name))
+	}
+	sort.Strings(categories)
+
+	h := sha256.New()
+	for _, part := range []string{
+		article.Title,
+		article.Description,
+		article.Content,
+		article.Author,
+		article.ImageURL,
+		strings.Join(categories, ","),
+	} {
+		// The length prefix keeps ("ab", "c") and ("a", "bc") apart.
+		fmt.Fprintf(h, "%d:%s|", len(part), part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// categoryNames returns the names of categories in their stored order.
+func categoryNames(categories []models.ArticleCategory) []string {
+	names := make([]string, 0, len(categories))
+	for _, category := range categories {
+		names = append(names, category.Name)
+	}
+	return names
+}
+
+// sameCategories reports whether a and b hold the same category names,
+// ignoring order and case like articleContentHash.
+func sameCategories(a, b []models.ArticleCategory) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	names := make(map[string]int, len(a))
+	for _, category := range a {
+		names[strings.ToLower(category.Name)]++
+	}
+	for _, category := range b {
+		name := strings.ToLower(category.Name)
+		if names[name] == 0 {
+			return false
+		}
+		names[name]--
+	}
+	return true
+}
+
+// updateArticle replaces the stored content of existing with incoming when
+// its content hash changed, keeping the previous version as a revision. A
+// change that only fills in fields the stored version lacks, such as the
+// author or image of articles stored before those were kept, is not a
+// revision. It reports whether the article was updated.
+func updateArticle(db *gorm.DB, existing *models.Article, incoming models.Article) (bool, error) {
+	if existing.ContentHash != "" && existing.ContentHash == incoming.ContentHash {
+		return false, nil
+	}
+
+	if err := db.Model(existing).Association("Categories").Find(&existing.Categories); err != nil {
+		return false, fmt.Errorf("failed to load categories: %w", err)
+	}
+	if existing.ContentHash == "" {
+		// Articles stored before hashing was introduced get their hash
+		// computed from the stored fields.
+		existing.ContentHash = articleContentHash(existing)
+		if existing.ContentHash == incoming.ContentHash {
+			err := db.Model(existing).Update("content_hash", existing.ContentHash).Error
+			if err != nil {
+				return false, fmt.Errorf("failed to store content hash: %w", err)
+			}
+			return false, nil
+		}
+	}
+
+	var changed []string
+	revised := false
+	compare := func(field string, differs, wasEmpty bool) {
+		if differs {
+			changed = append(changed, field)
+			revised = revised || !wasEmpty
+		}
+	}
+	compare("title", existing.Title != incoming.Title, existing.Title == "")
+	compare("description", existing.Description != incoming.Description, existing.Description == "")
+	compare("content", existing.Content != incoming.Content, existing.Content == "")
+	compare("author", existing.Author != incoming.Author, existing.Author == "")
+	compare("image", existing.ImageURL != incoming.ImageURL, existing.ImageURL == "")
+	compare("categories", !sameCategories(existing.Categories, incoming.Categories), len(existing.Categories) == 0)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if revised {
+			revision := models.ArticleRevision{
+				ArticleID:     existing.ID,
+				Title:         existing.Title,
+				Description:   existing.Description,
+				Content:       existing.Content,
+				Author:        existing.Author,
+				ImageURL:      existing.ImageURL,
+				Categories:    categoryNames(existing.Categories),
+				ContentHash:   existing.ContentHash,
+				ChangedFields: strings.Join(changed, ","),
+			}
+			if err := tx.Create(&revision).Error; err != nil {
+				return fmt.Errorf("failed to store revision: %w", err)
+			}
+		}
+
+		err := tx.Model(existing).Updates(map[string]interface{}{
+			"title":            incoming.Title,
+			"description":      incoming.Description,
+			"description_text": incoming.DescriptionText,
+			"content":          incoming.Content,
+			"content_text":     incoming.ContentText,
+			"sanitized":        incoming.Sanitized,
+			"author":           incoming.Author,
+			"image_url":        incoming.ImageURL,
+			"content_hash":     incoming.ContentHash,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update article: %w", err)
+		}
+
+		if err := tx.Unscoped().Where("article_id = ?", existing.ID).Delete(&models.ArticleAuthor{}).Error; err != nil {
+			return fmt.Errorf("failed to replace authors: %w", err)
+		}
+		if err := tx.Unscoped().Where("article_id = ?", existing.ID).Delete(&models.ArticleCategory{}).Error; err != nil {
+			return fmt.Errorf("failed to replace categories: %w", err)
+		}
+		if err := tx.Unscoped().Where("article_id = ?", existing.ID).Delete(&models.ArticleEnclosure{}).Error; err != nil {
+			return fmt.Errorf("failed to replace enclosures: %w", err)
+		}
+		for i := range incoming.Authors {
+			incoming.Authors[i].ArticleID = existing.ID
+		}
+		for i := range incoming.Categories {
+			incoming.Categories[i].ArticleID = existing.ID
+		}
+		for i := range incoming.Enclosures {
+			incoming.Enclosures[i].ArticleID = existing.ID
+		}
+		if len(incoming.Authors) > 0 {
+			if err := tx.Create(&incoming.Authors).Error; err != nil {
+				return fmt.Errorf("failed to store authors: %w", err)
+			}
+		}
+		if len(incoming.Categories) > 0 {
+			if err := tx.Create(&incoming.Categories).Error; err != nil {
+				return fmt.Errorf("failed to store categories: %w", err)
+			}
+		}
+		if len(incoming.Enclosures) > 0 {
+			if err := tx.Create(&incoming.Enclosures).Error; err != nil {
+				return fmt.Errorf("failed to store enclosures: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// itemAuthors returns the names of the authors of an item, without
+// duplicates.
+func itemAuthors(item *gofeed.Item) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, author := range item.Authors {
+		if author == nil {
+			continue
+		}
+		name := strings.TrimSpace(author.Name)
+		if name == "" {
+			name = strings.TrimSpace(author.Email)
+		}
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// itemImageURL returns the image of an item, falling back to the first
+// image enclosure.
+func itemImageURL(item *gofeed.Item) string {
+	if item.Image != nil && item.Image.URL != "" {
+		return truncate(item.Image.URL, 1000)
+	}
+	for _, enclosure := range item.Enclosures {
+		if enclosure != nil && enclosure.URL != "" && strings.HasPrefix(enclosure.Type, "image/") {
+			return truncate(enclosure.URL, 1000)
+		}
+	}
+	return ""
+}
+
+// truncate cuts s to at most max runes so it fits its column.
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
+
+// sanitizeStoredArticles sanitizes articles stored before ingest
+// sanitization existed, in batches, and fills in their plain text fields.
+// The content hash is computed from the sanitized fields, so the next fetch
+// of an unchanged article does not see it as changed.
+func sanitizeStoredArticles(db *gorm.DB) error {
+	const batchSize = 200
+
+	total := 0
+	for {
+		var articles []models.Article
+		err := db.Select("id", "title", "description", "content", "extracted_content", "author", "image_url").
+			Preload("Categories").
+			Where("sanitized = ?", false).
+			Order("id ASC").
+			Limit(batchSize).
+			Find(&articles).Error
+		if err != nil {
+			return fmt.Errorf("failed to load unsanitized articles: %w", err)
+		}
+		if len(articles) == 0 {
+			break
+		}
+
+		for _, article := range articles {
+			article.Title = truncate(utils.HTMLToText(article.Title), 500)
+			article.Description = utils.SanitizeHTML(article.Description)
+			article.Content = utils.SanitizeHTML(article.Content)
+			err := db.Model(&models.Article{}).Where("id = ?", article.ID).Updates(map[string]interface{}{
+				"title":             article.Title,
+				"description":       article.Description,
+				"description_text":  utils.HTMLToText(article.Description),
+				"content":           article.Content,
+				"content_text":      utils.HTMLToText(article.Content),
+				"extracted_content": utils.SanitizeHTML(article.ExtractedContent),
+				"content_hash":      articleContentHash(&article),
+				"sanitized":         true,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("failed to sanitize article %d: %w", article.ID, err)
+			}
+		}
+		total += len(articles)
+	}
+
+	if total > 0 {
+		log.Printf("Sanitized %d previously stored article(s).", total)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+
+	"github.com/FarrelioGustiana/backend/config"
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+// Highlight markers passed to ts_headline. They are private use characters
+// that never occur in article text, so the snippet can be HTML escaped
+// before they are turned into <mark> tags.
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+// ArticleSearchOptions filters and pages a full-text search.
+type ArticleSearchOptions struct {
+	Query    string
+	Page     int
+	PageSize int
+	// FeedIDs limits results to these subscribed feeds.
+	FeedIDs []uint
+	// From and To bound the publication date.
+	From *time.Time
+	To   *time.Time
+	// UnreadOnly and ReadOnly filter by the user's read state.
+	UnreadOnly bool
+	ReadOnly   bool
+}
+
+// ArticleSearchResult is an article matching a search with its relevance
+// and highlighted excerpts. TitleHighlight and Snippet are HTML with the
+// matched terms wrapped in <mark>.
+type ArticleSearchResult struct {
+	Article        models.Article `json:"article"`
+	Rank           float64        `json:"rank"`
+	TitleHighlight string         `json:"titleHighlight"`
+	Snippet        string         `json:"snippet"`
+}
+
+// buildSearchQuery turns a user query into a tsquery SQL expression and its
+// arguments. Words are ANDed together, "quoted text" matches a phrase, a
+// trailing * matches prefixes and a leading - excludes a word or phrase.
+func buildSearchQuery(input string) (string, []interface{}, error) {
+	var parts []string
+	var args []interface{}
+	positive := false
+
+	add := func(term string, phrase bool, negate bool) {
+		prefix := !phrase && strings.HasSuffix(term, "*")
+		words := strings.FieldsFunc(term, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if len(words) == 0 {
+			return
+		}
+
+		var expr string
+		switch {
+		case phrase:
+			expr = fmt.Sprintf("phraseto_tsquery('%s', ?)", config.SearchLanguage)
+			args = append(args, strings.Join(words, " "))
+		case prefix:
+			// Leading words of a term like "open-sour*" must match fully,
+			// only the last one is a prefix.
+			var exprs []string
+			for i, word := range words {
+				if i == len(words)-1 {
+					exprs = append(exprs, fmt.Sprintf("to_tsquery('%s', ?)", config.SearchLanguage))
+					args = append(args, word+":*")
+				} else {
+					exprs = append(exprs, fmt.Sprintf("plainto_tsquery('%s', ?)", config.SearchLanguage))
+					args = append(args, word)
+				}
+			}
+			expr = strings.Join(exprs, " && ")
+		default:
+			expr = fmt.Sprintf("plainto_tsquery('%s', ?)", config.SearchLanguage)
+			args = append(args, strings.Join(words, " "))
+		}
+
+		if negate {
+			expr = "!!(" + expr + ")"
+		} else {
+			positive = true
+		}
+		parts = append(parts, "("+expr+")")
+	}
+
+	rest := strings.TrimSpace(input)
+	for rest != "" {
+		negate := false
+		if strings.HasPrefix(rest, "-") {
+			negate = true
+			rest = rest[1:]
+		}
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				add(rest[1:], true, negate)
+				break
+			}
+			add(rest[1:end+1], true, negate)
+			rest = strings.TrimSpace(rest[end+2:])
+			continue
+		}
+
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			add(rest, false, negate)
+			break
+		}
+		add(rest[:end], false, negate)
+		rest = strings.TrimSpace(rest[end:])
+	}
+
+	if !positive {
+		return "", nil, errors.New("search query is empty")
+	}
+	return strings.Join(parts, " && "), args, nil
+}
+
+// highlightToHTML escapes a ts_headline result and turns its markers into
+// <mark> tags.
+func highlightToHTML(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
+
+// SearchArticles runs a full-text search over the articles of the feeds
+// userID is subscribed to, best matches first.
+func SearchArticles(userID string, opts ArticleSearchOptions) ([]ArticleSearchResult, int64, error) {
+	tsquery, queryArgs, err := buildSearchQuery(opts.Query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	subscribedFeedIDs, err := getSubscribedFeedIDs(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	feedIDs := subscribedFeedIDs
+	if len(opts.FeedIDs) > 0 {
+		subscribed := make(map[uint]bool, len(subscribedFeedIDs))
+		for _, id := range subscribedFeedIDs {
+			subscribed[id] = true
+		}
+		feedIDs = nil
+		for _, id := range opts.FeedIDs {
+			if subscribed[id] {
+				feedIDs = append(feedIDs, id)
+			}
+		}
+	}
+	if len(feedIDs) == 0 {
+		return []ArticleSearchResult{}, 0, nil
+	}
+
+	match := gorm.Expr("("+tsquery+")", queryArgs...)
+
+	query := config.DB.Model(&models.Article{}).
+		Where("articles.feed_id IN ?", feedIDs).
+		Where("articles.search_vector @@ ?", match)
+	if opts.From != nil {
+		query = query.Where("articles.pub_date >= ?", *opts.From)
+	}
+	if opts.To != nil {
+		query = query.Where("articles.pub_date <= ?", *opts.To)
+	}
+	if opts.UnreadOnly {
+		query = unreadArticles(query, userID)
+	}
+	if opts.ReadOnly {
+		query = query.Where("EXISTS (?)", config.DB.Model(&models.UserArticleState{}).
+			Select("1").
+			Where("user_article_states.article_id = articles.id AND user_article_states.user_id = ? AND user_article_states.is_read", userID))
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	var ranked []struct {
+		ID   uint
+		Rank float64
+	}
+	err = query.Select("articles.id, ts_rank_cd(articles.search_vector, ?) AS rank", match).
+		Order("rank DESC, articles.pub_date DESC, articles.id DESC").
+		Limit(opts.PageSize).
+		Offset((opts.Page - 1) * opts.PageSize).
+		Scan(&ranked).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search articles: %w", err)
+	}
+	if len(ranked) == 0 {
+		return []ArticleSearchResult{}, total, nil
+	}
+
+	ids := make([]uint, len(ranked))
+	for i, row := range ranked {
+		ids[i] = row.ID
+	}
+
+	// Headlines are expensive, so they are only computed for the page.
+	headlineOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=30, MinWords=10, FragmentDelimiter=\" … \"", highlightStart, highlightStop)
+	var headlines []struct {
+		ID             uint
+		TitleHighlight string
+		Snippet        string
+	}
+	err = config.DB.Model(&models.Article{}).
+		Select(fmt.Sprintf("articles.id, ts_headline('%[1]s', articles.title, ?, 'HighlightAll=true, StartSel=%[2]s, StopSel=%[3]s') AS title_highlight, ts_headline('%[1]s', coalesce(nullif(articles.content_text, ''), articles.description_text, ''), ?, ?) AS snippet", config.SearchLanguage, highlightStart, highlightStop),
+			match, match, headlineOptions).
+		Where("articles.id IN ?", ids).
+		Scan(&headlines).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to highlight search results: %w", err)
+	}
+
+	var articles []models.Article
+	if err := config.DB.Preload("Feed").Where("id IN ?", ids).Find(&articles).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve search results: %w", err)
+	}
+	if err := fillArticleStates(userID, articles); err != nil {
+		return nil, 0, err
+	}
+
+	articlesByID := make(map[uint]models.Article, len(articles))
+	for _, article := range articles {
+		articlesByID[article.ID] = article
+	}
+	highlightsByID := make(map[uint]int, len(headlines))
+	for i, headline := range headlines {
+		highlightsByID[headline.ID] = i
+	}
+
+	results := make([]ArticleSearchResult, 0, len(ranked))
+	for _, row := range ranked {
+		article, ok := articlesByID[row.ID]
+		if !ok {
+			continue
+		}
+		result := ArticleSearchResult{Article: article, Rank: row.Rank}
+		if i, ok := highlightsByID[row.ID]; ok {
+			result.TitleHighlight = highlightToHTML(headlines[i].TitleHighlight)
+			result.Snippet = highlightToHTML(headlines[i].Snippet)
+		}
+		results = append(results, result)
+	}
+
+	return results, total, nil
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -10,29 +11,176 @@ import (
 	"github.com/FarrelioGustiana/backend/models"
 )
 
-func GetArticlesForUser(userID string, page, pageSize int) ([]models.Article, int64, error) {
+// ArticleListOptions controls how GetArticlesForUser pages and groups articles.
+type ArticleListOptions struct {
+	Page     int
+	PageSize int
+	// CollapseStories shows only the first article of each story cluster.
+	CollapseStories bool
+	// UnreadOnly leaves out articles the user has read.
+	UnreadOnly bool
+	// FeedIDs limits the list to these subscribed feeds and Folder to the
+	// subscriptions filed in that folder.
+	FeedIDs []uint
+	Folder  string
+	// From and To bound the publication date.
+	From *time.Time
+	To   *time.Time
+	// Author and Category match case-insensitively, Author any one of the
+	// authors of an article.
+	Author   string
+	Category string
+	// SortBy is "published" (the default), "ingested" or "title".
+	SortBy string
+	// Ascending reverses the default newest first or Z to A order.
+	Ascending bool
+	// SkipCount leaves out counting the matching articles, which is the
+	// slowest part of listing on large tables.
+	SkipCount bool
+}
+
+// articleSortColumns maps the sort keys of ArticleListOptions to columns.
+var articleSortColumns = map[string]string{
+	"":          "articles.pub_date",
+	"published": "articles.pub_date",
+	"ingested":  "articles.created_at",
+	"title":     "articles.title",
+}
+
+// getSubscribedFeedIDs returns the IDs of the feeds userID is subscribed to.
+func getSubscribedFeedIDs(userID string) ([]uint, error) {
 	var subscribedFeedIDs []uint
-	config.DB.Model(&models.Subscription{}).
+	err := config.DB.Model(&models.Subscription{}).
 		Where("user_id = ?", userID).
-		Pluck("feed_id", &subscribedFeedIDs)
+		Pluck("feed_id", &subscribedFeedIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve subscribed feeds: %w", err)
+	}
+	return subscribedFeedIDs, nil
+}
+
+// listedFeedIDs returns the subscribed feeds of userID that opts selects.
+func listedFeedIDs(userID string, opts ArticleListOptions) ([]uint, error) {
+	query := config.DB.Model(&models.Subscription{}).Where("user_id = ?", userID)
+	if len(opts.FeedIDs) > 0 {
+		query = query.Where("feed_id IN ?", opts.FeedIDs)
+	}
+	if opts.Folder != "" {
+		query = query.Where("folder = ?", opts.Folder)
+	}
+
+	var feedIDs []uint
+	if err := query.Pluck("feed_id", &feedIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve subscribed feeds: %w", err)
+	}
+	return feedIDs, nil
+}
+
+// listedArticles narrows a query on articles to the ones of feedIDs that are
+// listed, which may be a slice or a subquery. A story carried by several of
+// the feeds is listed once, from the feed that published it first; with
+// collapse, a story cluster is listed through its first article only.
+func listedArticles(query *gorm.DB, feedIDs interface{}, collapse bool) *gorm.DB {
+	query = query.Where("articles.feed_id IN (?)", feedIDs).
+		Where(config.DB.
+			Where("articles.duplicate_of_id IS NULL").
+			Or("articles.duplicate_of_id NOT IN (?)", config.DB.Model(&models.Article{}).Select("id").Where("feed_id IN (?)", feedIDs)))
+
+	if collapse {
+		firstOfCluster := config.DB.Model(&models.Article{}).
+			Select("MIN(id)").
+			Where("feed_id IN (?) AND cluster_id IS NOT NULL", feedIDs).
+			Group("cluster_id")
+		query = query.Where(config.DB.Where("articles.cluster_id IS NULL").Or("articles.id IN (?)", firstOfCluster))
+	}
+	return query
+}
+
+// articleListQuery builds the query selecting the articles of the feeds
+// userID is subscribed to that opts asks for. It returns a nil query when the
+// selection is empty.
+func articleListQuery(userID string, opts ArticleListOptions) (*gorm.DB, error) {
+	subscribedFeedIDs, err := listedFeedIDs(userID, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(subscribedFeedIDs) == 0 {
+		return nil, nil
+	}
+
+	query := listedArticles(config.DB.Model(&models.Article{}), subscribedFeedIDs, opts.CollapseStories)
+
+	if opts.UnreadOnly {
+		query = unreadArticles(query, userID)
+	}
+	if opts.From != nil {
+		query = query.Where("articles.pub_date >= ?", *opts.From)
+	}
+	if opts.To != nil {
+		query = query.Where("articles.pub_date <= ?", *opts.To)
+	}
+	if opts.Author != "" {
+		query = query.Where("EXISTS (?)", config.DB.Model(&models.ArticleAuthor{}).
+			Select("1").
+			Where("article_authors.article_id = articles.id AND LOWER(article_authors.name) = LOWER(?)", opts.Author))
+	}
+	if opts.Category != "" {
+		query = query.Where("EXISTS (?)", config.DB.Model(&models.ArticleCategory{}).
+			Select("1").
+			Where("article_categories.article_id = articles.id AND LOWER(article_categories.name) = LOWER(?)", opts.Category))
+	}
+
+	// The session makes query reusable for both the count and the page.
+	return query.Session(&gorm.Session{}), nil
+}
+
+// articleOrder returns the ORDER BY clause for sorting on column, with the
+// article ID breaking ties. Articles without a value always come last;
+// reverse flips the whole order, which keyset pagination uses to walk
+// backwards.
+func articleOrder(column string, ascending bool, reverse bool) string {
+	direction, nulls := "DESC", "NULLS LAST"
+	if ascending != reverse {
+		direction = "ASC"
+	}
+	if reverse {
+		nulls = "NULLS FIRST"
+	}
+	return fmt.Sprintf("%s %s %s, articles.id %s", column, direction, nulls, direction)
+}
+
+// GetArticlesForUser returns a page of the articles of the feeds userID is
+// subscribed to, filtered and sorted as opts asks. The total is 0 when
+// opts.SkipCount is set.
+func GetArticlesForUser(userID string, opts ArticleListOptions) ([]models.Article, int64, error) {
+	sortColumn, ok := articleSortColumns[opts.SortBy]
+	if !ok {
+		return nil, 0, errors.New("invalid sort field")
+	}
+
+	query, err := articleListQuery(userID, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if query == nil {
 		return []models.Article{}, 0, nil
 	}
 
 	var articles []models.Article
 	var totalArticles int64
 
-	offset := (page - 1) * pageSize
+	offset := (opts.Page - 1) * opts.PageSize
 
-	config.DB.Model(&models.Article{}).
-		Where("feed_id IN (?)", subscribedFeedIDs).
-		Count(&totalArticles)
+	if !opts.SkipCount {
+		if err := query.Count(&totalArticles).Error; err != nil {
+			return nil, 0, fmt.Errorf("failed to count articles for user: %w", err)
+		}
+	}
 
-	result := config.DB.Preload("Feed").
-		Where("feed_id IN (?)", subscribedFeedIDs).
-		Order("pub_date DESC").
-		Limit(pageSize).
+	result := query.Preload("Feed").
+		Order(articleOrder(sortColumn, opts.Ascending, false)).
+		Limit(opts.PageSize).
 		Offset(offset).
 		Find(&articles)
 
@@ -40,16 +188,22 @@ func GetArticlesForUser(userID string, page, pageSize int) ([]models.Article, in
 		return nil, 0, fmt.Errorf("failed to retrieve articles for user: %w", result.Error)
 	}
 
+	if err := fillArticleStates(userID, articles); err != nil {
+		return nil, 0, err
+	}
+
 	return articles, totalArticles, nil
 }
 
 func GetArticleByID(articleID uint, userID string) (*models.Article, error) {
 	var article models.Article
 
-	result := config.DB.Preload("Feed").
-		Joins("JOIN subscriptions ON subscriptions.feed_id = articles.feed_id").
-		Where("articles.id = ? AND subscriptions.user_id = ?", articleID, userID).
-		First(&article)
+	query := config.DB.Preload("Feed").
+		Preload("Authors").
+		Preload("Categories").
+		Preload("Enclosures").
+		Where("articles.id = ?", articleID)
+	result := visibleArticles(query, userID).First(&article)
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -58,5 +212,29 @@ func GetArticleByID(articleID uint, userID string) (*models.Article, error) {
 		return nil, fmt.Errorf("database error retrieving article: %w", result.Error)
 	}
 
+	articles := []models.Article{article}
+	if err := fillArticleStates(userID, articles); err != nil {
+		return nil, err
+	}
+	article = articles[0]
+
 	return &article, nil
 }
+
+// GetArticleRevisions returns the previous versions of an article, newest
+// first, as long as the user can see the article.
+func GetArticleRevisions(articleID uint, userID string) ([]models.ArticleRevision, error) {
+	if _, err := GetArticleByID(articleID, userID); err != nil {
+		return nil, err
+	}
+
+	var revisions []models.ArticleRevision
+	result := config.DB.Where("article_id = ?", articleID).
+		Order("created_at DESC").
+		Find(&revisions)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve article revisions: %w", result.Error)
+	}
+
+	return revisions, nil
+}
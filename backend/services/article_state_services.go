@@ -0,0 +1,259 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/FarrelioGustiana/backend/config"
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+// unreadArticles narrows a query on articles to the ones userID has not read.
+func unreadArticles(query *gorm.DB, userID string) *gorm.DB {
+	return query.Where("NOT EXISTS (?)", config.DB.Model(&models.UserArticleState{}).
+		Select("1").
+		Where("user_article_states.article_id = articles.id AND user_article_states.user_id = ? AND user_article_states.is_read", userID))
+}
+
+// fillArticleStates sets the per-user fields of articles for userID.
+func fillArticleStates(userID string, articles []models.Article) error {
+	if len(articles) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(articles))
+	for i := range articles {
+		ids[i] = articles[i].ID
+	}
+
+	var states []models.UserArticleState
+	err := config.DB.Where("user_id = ? AND article_id IN ?", userID, ids).Find(&states).Error
+	if err != nil {
+		return fmt.Errorf("failed to retrieve article states: %w", err)
+	}
+
+	byArticle := make(map[uint]models.UserArticleState, len(states))
+	for _, state := range states {
+		byArticle[state.ArticleID] = state
+	}
+	for i := range articles {
+		articles[i].IsRead = byArticle[articles[i].ID].IsRead
+		articles[i].IsStarred = byArticle[articles[i].ID].IsStarred
+	}
+	return nil
+}
+
+// visibleArticles narrows a query on articles to the ones userID may read:
+// articles of subscribed feeds and articles the user starred, which stay
+// readable after unsubscribing.
+func visibleArticles(query *gorm.DB, userID string) *gorm.DB {
+	return query.Where(config.DB.
+		Where("articles.feed_id IN (?)", config.DB.Model(&models.Subscription{}).Select("feed_id").Where("user_id = ?", userID)).
+		Or("EXISTS (?)", config.DB.Model(&models.UserArticleState{}).
+			Select("1").
+			Where("user_article_states.article_id = articles.id AND user_article_states.user_id = ? AND user_article_states.is_starred", userID)))
+}
+
+// visibleArticleIDs returns the IDs out of articleIDs that userID may read.
+func visibleArticleIDs(userID string, articleIDs []uint) ([]uint, error) {
+	if len(articleIDs) == 0 {
+		return nil, nil
+	}
+
+	var visible []uint
+	err := visibleArticles(config.DB.Model(&models.Article{}).Where("articles.id IN ?", articleIDs), userID).
+		Pluck("articles.id", &visible).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to check articles: %w", err)
+	}
+	return visible, nil
+}
+
+// SetArticlesReadState marks the given articles read or unread for userID and
+// returns how many were changed. Articles the user cannot see are ignored.
+func SetArticlesReadState(userID string, articleIDs []uint, read bool) (int64, error) {
+	visible, err := visibleArticleIDs(userID, articleIDs)
+	if err != nil {
+		return 0, err
+	}
+	if len(visible) == 0 {
+		return 0, nil
+	}
+
+	if !read {
+		result := config.DB.Model(&models.UserArticleState{}).
+			Where("user_id = ? AND article_id IN ? AND is_read", userID, visible).
+			Updates(map[string]interface{}{"is_read": false, "read_at": nil})
+		if result.Error != nil {
+			return 0, fmt.Errorf("failed to mark articles unread: %w", result.Error)
+		}
+		return result.RowsAffected, nil
+	}
+
+	now := time.Now()
+	states := make([]models.UserArticleState, len(visible))
+	for i, articleID := range visible {
+		states[i] = models.UserArticleState{UserID: userID, ArticleID: articleID, IsRead: true, ReadAt: &now}
+	}
+
+	result := config.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "article_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"is_read":    true,
+			"read_at":    now,
+			"updated_at": now,
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_article_states.is_read = false"}}},
+	}).Create(&states)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to mark articles read: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// SetArticleReadState marks a single article read or unread for userID.
+func SetArticleReadState(userID string, articleID uint, read bool) error {
+	visible, err := visibleArticleIDs(userID, []uint{articleID})
+	if err != nil {
+		return err
+	}
+	if len(visible) == 0 {
+		return errors.New("article not found or not subscribed")
+	}
+
+	_, err = SetArticlesReadState(userID, visible, read)
+	return err
+}
+
+// MarkAllArticlesRead marks every article published up to before as read for
+// userID, in one subscribed feed when feedID is set or in all of them.
+func MarkAllArticlesRead(userID string, feedID *uint, before time.Time) (int64, error) {
+	subscribedFeedIDs, err := getSubscribedFeedIDs(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	feedIDs := subscribedFeedIDs
+	if feedID != nil {
+		feedIDs = nil
+		for _, id := range subscribedFeedIDs {
+			if id == *feedID {
+				feedIDs = []uint{id}
+			}
+		}
+		if feedIDs == nil {
+			return 0, errors.New("subscription not found")
+		}
+	}
+	if len(feedIDs) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	result := config.DB.Exec(`INSERT INTO user_article_states (user_id, article_id, is_read, read_at, created_at, updated_at)
+		SELECT ?, articles.id, true, ?, ?, ?
+		FROM articles
+		WHERE articles.feed_id IN ? AND articles.pub_date <= ? AND articles.deleted_at IS NULL
+		ON CONFLICT (user_id, article_id) DO UPDATE
+		SET is_read = true, read_at = EXCLUDED.read_at, updated_at = EXCLUDED.updated_at
+		WHERE user_article_states.is_read = false`,
+		userID, now, now, now, feedIDs, before)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to mark articles read: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// getUnreadCounts returns the number of unread articles per subscribed feed
+// of userID, counting only the articles the article list shows, see
+// listedArticles. Feeds without unread articles are missing from the map.
+func getUnreadCounts(userID string, collapse bool) (map[uint]int64, error) {
+	var rows []struct {
+		FeedID uint
+		Count  int64
+	}
+	subscribedFeedIDs := config.DB.Model(&models.Subscription{}).Select("feed_id").Where("user_id = ?", userID)
+	query := listedArticles(config.DB.Model(&models.Article{}).Select("articles.feed_id, COUNT(*) AS count"), subscribedFeedIDs, collapse)
+	err := unreadArticles(query, userID).
+		Group("articles.feed_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread articles: %w", err)
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.FeedID] = row.Count
+	}
+	return counts, nil
+}
+
+// SetArticleStarred stars or unstars an article for userID.
+func SetArticleStarred(userID string, articleID uint, starred bool) error {
+	visible, err := visibleArticleIDs(userID, []uint{articleID})
+	if err != nil {
+		return err
+	}
+	if len(visible) == 0 {
+		return errors.New("article not found or not subscribed")
+	}
+
+	if !starred {
+		err := config.DB.Model(&models.UserArticleState{}).
+			Where("user_id = ? AND article_id = ?", userID, articleID).
+			Updates(map[string]interface{}{"is_starred": false, "starred_at": nil}).Error
+		if err != nil {
+			return fmt.Errorf("failed to unstar article: %w", err)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	state := models.UserArticleState{UserID: userID, ArticleID: articleID, IsStarred: true, StarredAt: &now}
+	err = config.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "article_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"is_starred": true,
+			"starred_at": now,
+			"updated_at": now,
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_article_states.is_starred = false"}}},
+	}).Create(&state).Error
+	if err != nil {
+		return fmt.Errorf("failed to star article: %w", err)
+	}
+	return nil
+}
+
+// GetStarredArticles returns the articles userID starred, most recently
+// starred first, whether or not the user is still subscribed to their feeds.
+func GetStarredArticles(userID string, page, pageSize int) ([]models.Article, int64, error) {
+	query := config.DB.Model(&models.Article{}).
+		Joins("JOIN user_article_states ON user_article_states.article_id = articles.id AND user_article_states.user_id = ? AND user_article_states.is_starred AND user_article_states.deleted_at IS NULL", userID).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count starred articles: %w", err)
+	}
+
+	var articles []models.Article
+	result := query.Preload("Feed").
+		Order("user_article_states.starred_at DESC, articles.id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&articles)
+	if result.Error != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve starred articles: %w", result.Error)
+	}
+
+	if err := fillArticleStates(userID, articles); err != nil {
+		return nil, 0, err
+	}
+
+	return articles, total, nil
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxArticlePageBytes caps how much of an article page is downloaded.
+	maxArticlePageBytes = 5 << 20
+	// minParagraphLength is the shortest text that counts as a paragraph
+	// when scoring content candidates.
+	minParagraphLength = 25
+)
+
+var (
+	// unlikelyContent matches class names and IDs of page chrome that never
+	// holds the article body.
+	unlikelyContent = regexp.MustCompile(`(?i)comment|sidebar|footer|masthead|menu|nav|share|social|promo|sponsor|advert|\bads?\b|related|recommend|subscribe|newsletter|cookie|popup|modal|banner|breadcrumb|pagination`)
+	// likelyContent matches class names and IDs that usually wrap the body.
+	likelyContent = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text|blog`)
+	whitespace    = regexp.MustCompile(`\s+`)
+)
+
+// ExtractedContent is the main content of an article page.
+type ExtractedContent struct {
+	HTML string
+	Text string
+}
+
+// extractArticleContent downloads pageURL and extracts its main content.
+func extractArticleContent(ctx context.Context, client *http.Client, pageURL string) (*ExtractedContent, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	_, cfg := sharedFetchClient()
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	body, err := readLimitedBody(resp.Body, maxArticlePageBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page: %w", err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page: %w", err)
+	}
+
+	base := resp.Request.URL
+	return extractFromDocument(doc, base)
+}
+
+// extractFromDocument finds the element of doc that most likely holds the
+// article body, in the spirit of Readability: paragraphs award points to
+// their parent and grandparent, class names and IDs adjust the score and
+// link heavy elements are penalized.
+func extractFromDocument(doc *goquery.Document, base *url.URL) (*ExtractedContent, error) {
+	doc.Find("script, style, noscript, iframe, form, nav, header, footer, aside, svg, button, input, select, textarea, object, embed").Remove()
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		if goquery.NodeName(s) == "body" || goquery.NodeName(s) == "html" || goquery.NodeName(s) == "article" {
+			return
+		}
+		hint := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if unlikelyContent.MatchString(hint) && !likelyContent.MatchString(hint) {
+			s.Remove()
+		}
+	})
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*goquery.Selection
+
+	addScore := func(s *goquery.Selection, points float64) {
+		if s.Length() == 0 {
+			return
+		}
+		node := s.Get(0)
+		if _, ok := scores[node]; !ok {
+			scores[node] = classWeight(s)
+			candidates = append(candidates, s)
+		}
+		scores[node] += points
+	}
+
+	doc.Find("p, pre, td").Each(func(_ int, p *goquery.Selection) {
+		text := strings.TrimSpace(p.Text())
+		if len(text) < minParagraphLength {
+			return
+		}
+		points := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		addScore(p.Parent(), points)
+		addScore(p.Parent().Parent(), points/2)
+	})
+
+	var best *goquery.Selection
+	bestScore := 0.0
+	for _, candidate := range candidates {
+		score := scores[candidate.Get(0)] * (1 - linkDensity(candidate))
+		if best == nil || score > bestScore {
+			best = candidate
+			bestScore = score
+		}
+	}
+
+	if best == nil {
+		best = doc.Find("article").First()
+	}
+	if best.Length() == 0 {
+		return nil, errors.New("no article content found")
+	}
+
+	absolutizeURLs(best, base)
+
+	content, err := best.Html()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render content: %w", err)
+	}
+	text := strings.TrimSpace(whitespace.ReplaceAllString(best.Text(), " "))
+	if text == "" {
+		return nil, errors.New("no article content found")
+	}
+
+	return &ExtractedContent{HTML: strings.TrimSpace(content), Text: text}, nil
+}
+
+// classWeight scores an element by its class name and ID.
+func classWeight(s *goquery.Selection) float64 {
+	weight := 0.0
+	for _, hint := range []string{s.AttrOr("class", ""), s.AttrOr("id", "")} {
+		if hint == "" {
+			continue
+		}
+		if likelyContent.MatchString(hint) {
+			weight += 25
+		}
+		if unlikelyContent.MatchString(hint) {
+			weight -= 25
+		}
+	}
+	switch goquery.NodeName(s) {
+	case "article", "main":
+		weight += 10
+	case "div":
+		weight += 5
+	}
+	return weight
+}
+
+// linkDensity is the share of the text of s that sits inside links.
+func linkDensity(s *goquery.Selection) float64 {
+	textLength := len(strings.TrimSpace(s.Text()))
+	if textLength == 0 {
+		return 1
+	}
+	linkLength := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linkLength += len(strings.TrimSpace(a.Text()))
+	})
+	return float64(linkLength) / float64(textLength)
+}
+
+// absolutizeURLs rewrites relative links and image sources in s against base.
+func absolutizeURLs(s *goquery.Selection, base *url.URL) {
+	if base == nil {
+		return
+	}
+	for _, attr := range []string{"href", "src"} {
+		s.Find("[" + attr + "]").Each(func(_ int, el *goquery.Selection) {
+			value, _ := el.Attr(attr)
+			ref, err := url.Parse(strings.TrimSpace(value))
+			if err != nil {
+				return
+			}
+			el.SetAttr(attr, base.ResolveReference(ref).String())
+		})
+	}
+}
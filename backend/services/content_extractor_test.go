@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const articleBody = `
+<p>The council approved the new budget on Tuesday, after a debate that lasted well into the night, with seven votes in favour.</p>
+<p>Spending on public transport rises by a fifth, while the road maintenance budget, long criticised as too small, stays flat.</p>
+<p>Opposition members said the plan relies on optimistic revenue forecasts, and promised to revisit it in the spring.</p>
+<p>Read the <a href="/budget.pdf">full budget</a> for details.</p>`
+
+// teaserPage is the page of an article whose feed only carries its first
+// sentence.
+const teaserPage = `<!DOCTYPE html>
+<html><head><title>Budget approved</title></head>
+<body>
+<div class="post-content">` + articleBody + `</div>
+</body></html>`
+
+// chromePage wraps the same article in navigation, a sidebar, share buttons
+// and a footer.
+const chromePage = `<!DOCTYPE html>
+<html><head><title>Budget approved</title><script>trackVisit();</script></head>
+<body>
+<header><a href="/">City News</a></header>
+<nav class="main-menu"><a href="/politics">Politics</a> <a href="/sports">Sports</a> <a href="/weather">Weather</a></nav>
+<div id="sidebar"><p>Most read: the mayor opens a new bridge, a local bakery wins a national prize, and more.</p></div>
+<article><div class="entry">` + articleBody + `</div>
+<div class="share-buttons"><a href="https://social.example/share">Share this story with your friends and family</a></div>
+</article>
+<div class="related-stories"><p>Related: last year's budget, which was approved after a similar debate, is still in effect.</p></div>
+<footer><p>Copyright City News, all rights reserved, reproduction is prohibited without permission.</p></footer>
+</body></html>`
+
+func TestExtractFromDocument(t *testing.T) {
+	base, _ := url.Parse("https://news.example/2024/budget")
+
+	tests := []struct {
+		name       string
+		page       string
+		wantErr    bool
+		contains   []string
+		notContain []string
+	}{
+		{
+			name:     "teaser page",
+			page:     teaserPage,
+			contains: []string{"approved the new budget", "revisit it in the spring", `href="https://news.example/budget.pdf"`},
+		},
+		{
+			name:       "page with nav and sidebar chrome",
+			page:       chromePage,
+			contains:   []string{"approved the new budget", "revisit it in the spring"},
+			notContain: []string{"Politics", "Most read", "Share this story", "Related:", "Copyright", "trackVisit"},
+		},
+		{
+			name:    "page without content",
+			page:    `<html><body><nav><a href="/">Home</a></nav></body></html>`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatalf("failed to parse page: %v", err)
+			}
+
+			extracted, err := extractFromDocument(doc, base)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", extracted.Text)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, want := range tt.contains {
+				if !strings.Contains(extracted.HTML, want) {
+					t.Errorf("content is missing %q:\n%s", want, extracted.HTML)
+				}
+			}
+			for _, unwanted := range tt.notContain {
+				if strings.Contains(extracted.HTML, unwanted) || strings.Contains(extracted.Text, unwanted) {
+					t.Errorf("content contains %q:\n%s", unwanted, extracted.HTML)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractArticleContent(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/teaser", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(teaserPage))
+	})
+	mux.HandleFunc("/chrome", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(chromePage))
+	})
+	mux.HandleFunc("/report.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.7"))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body><div class=\"content\"><p>"))
+		w.Write([]byte(strings.Repeat("All work and no play makes a very long page. ", maxArticlePageBytes/40)))
+		w.Write([]byte("</p></div></body></html>"))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		wantErr  error
+		failing  bool
+		contains string
+	}{
+		{name: "teaser page", path: "/teaser", contains: "approved the new budget"},
+		{name: "page with chrome", path: "/chrome", contains: "revisit it in the spring"},
+		{name: "non-HTML content type", path: "/report.pdf", failing: true},
+		{name: "oversized body", path: "/huge", wantErr: ErrResponseTooLarge},
+		{name: "missing page", path: "/missing", failing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extracted, err := extractArticleContent(context.Background(), server.Client(), server.URL+tt.path)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+			case tt.failing:
+				if err == nil {
+					t.Fatalf("expected an error, got %q", extracted.Text)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !strings.Contains(extracted.Text, tt.contains) {
+					t.Errorf("text is missing %q: %s", tt.contains, extracted.Text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/FarrelioGustiana/backend/config"
+	"github.com/FarrelioGustiana/backend/models"
+	"github.com/FarrelioGustiana/backend/utils"
+)
+
+var (
+	// ErrInvalidFeedAuth is returned for incomplete or unknown feed credentials.
+	ErrInvalidFeedAuth = errors.New("invalid feed authentication")
+	// ErrCredentialsKeyMissing is returned when credentials are set but no
+	// encryption key is configured.
+	ErrCredentialsKeyMissing = config.ErrCredentialsKeyMissing
+)
+
+// FeedAuthInput sets the authentication of a feed. Type is "none", "basic",
+// "bearer" or "header"; basic needs a Username, bearer needs a Token
+// and header needs HeaderName and HeaderValue.
+type FeedAuthInput struct {
+	Type        string
+	Username    string
+	Password    string
+	Token       string
+	HeaderName  string
+	HeaderValue string
+}
+
+// setFeedCredentials validates input and stores it on feed, encrypting the
+// secrets with the configured credentials key.
+func setFeedCredentials(feed *models.Feed, input FeedAuthInput) error {
+	var credentials models.FeedCredentials
+	headerName := ""
+
+	switch input.Type {
+	case "", "none":
+		feed.AuthType = models.FeedAuthNone
+		feed.AuthHeaderName = ""
+		feed.EncryptedCredentials = ""
+		return nil
+	case models.FeedAuthBasic:
+		if strings.TrimSpace(input.Username) == "" {
+			return fmt.Errorf("%w: basic auth needs a username", ErrInvalidFeedAuth)
+		}
+		credentials.Username = strings.TrimSpace(input.Username)
+		credentials.Password = input.Password
+	case models.FeedAuthBearer:
+		if strings.TrimSpace(input.Token) == "" {
+			return fmt.Errorf("%w: bearer auth needs a token", ErrInvalidFeedAuth)
+		}
+		credentials.Token = strings.TrimSpace(input.Token)
+	case models.FeedAuthHeader:
+		headerName = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(input.HeaderName))
+		// Unlike custom headers, header credentials may use Authorization
+		// or Cookie, they are stored encrypted.
+		if _, err := validateFeedHeader(headerName, input.HeaderValue); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidFeedAuth, err)
+		}
+		if input.HeaderValue == "" {
+			return fmt.Errorf("%w: header auth needs a header value", ErrInvalidFeedAuth)
+		}
+		credentials.HeaderValue = input.HeaderValue
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidFeedAuth, input.Type)
+	}
+
+	key, err := config.CredentialsKey()
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	encrypted, err := utils.EncryptSecret(key, plaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+
+	feed.AuthType = input.Type
+	feed.AuthHeaderName = headerName
+	feed.EncryptedCredentials = encrypted
+	return nil
+}
+
+// applyFeedCredentials decrypts the credentials of feed and adds them to req.
+func applyFeedCredentials(req *http.Request, feed *models.Feed) error {
+	if feed.AuthType == models.FeedAuthNone {
+		return nil
+	}
+
+	key, err := config.CredentialsKey()
+	if err != nil {
+		return err
+	}
+	plaintext, err := utils.DecryptSecret(key, feed.EncryptedCredentials)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt feed credentials: %w", err)
+	}
+	var credentials models.FeedCredentials
+	if err := json.Unmarshal(plaintext, &credentials); err != nil {
+		return fmt.Errorf("failed to decode feed credentials: %w", err)
+	}
+
+	switch feed.AuthType {
+	case models.FeedAuthBasic:
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+	case models.FeedAuthBearer:
+		req.Header.Set("Authorization", "Bearer "+credentials.Token)
+	case models.FeedAuthHeader:
+		req.Header.Set(feed.AuthHeaderName, credentials.HeaderValue)
+	default:
+		return fmt.Errorf("unknown feed auth type %q", feed.AuthType)
+	}
+	return nil
+}
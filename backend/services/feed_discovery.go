@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+const (
+	// maxDiscoveryPageBytes caps the size of pages and feeds downloaded
+	// during discovery.
+	maxDiscoveryPageBytes = 2 << 20
+	// discoveryTimeout bounds a whole discovery, including every probe.
+	discoveryTimeout = 30 * time.Second
+)
+
+// feedLinkTypes are the <link rel="alternate"> types that announce a feed.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+	"application/json":      true,
+	"application/rdf+xml":   true,
+	"text/xml":              true,
+}
+
+// commonFeedPaths are probed on the site root when a page does not
+// announce any feed.
+var commonFeedPaths = []string{
+	"/feed",
+	"/rss",
+	"/rss.xml",
+	"/feed.xml",
+	"/atom.xml",
+	"/index.xml",
+	"/feed.json",
+	"/feeds/posts/default",
+}
+
+// DiscoveredFeed is a feed found for a website.
+type DiscoveredFeed struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	// Type is the feed format: rss, atom or json.
+	Type string `json:"type"`
+	// Source tells how the feed was found: "direct" when the given URL is a
+	// feed itself, "link" for <link rel="alternate"> tags and "probe" for
+	// well-known paths.
+	Source string `json:"source"`
+}
+
+// DiscoverFeeds finds the feeds of the website at pageURL. It reads the
+// feeds announced by the page's <link rel="alternate"> tags and, when there
+// are none, probes common feed paths on the site. Every candidate is fetched
+// and parsed, only working feeds are returned. Discovery stops when ctx is
+// done or after discoveryTimeout.
+func DiscoverFeeds(ctx context.Context, pageURL string) ([]DiscoveredFeed, error) {
+	base, err := url.Parse(strings.TrimSpace(pageURL))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, errors.New("invalid URL")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	body, finalURL, err := downloadURL(ctx, base.String(), maxDiscoveryPageBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page: %w", err)
+	}
+
+	// The URL may already point at a feed.
+	if feed, err := gofeed.NewParser().Parse(bytes.NewReader(body)); err == nil {
+		return []DiscoveredFeed{{
+			URL:    finalURL.String(),
+			Title:  strings.TrimSpace(feed.Title),
+			Type:   feed.FeedType,
+			Source: "direct",
+		}}, nil
+	}
+
+	var found []DiscoveredFeed
+	seen := make(map[string]bool)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err == nil {
+		doc.Find("link[href]").Each(func(_ int, link *goquery.Selection) {
+			if !hasToken(link.AttrOr("rel", ""), "alternate") {
+				return
+			}
+			linkType := strings.ToLower(strings.TrimSpace(strings.Split(link.AttrOr("type", ""), ";")[0]))
+			if !feedLinkTypes[linkType] {
+				return
+			}
+			ref, err := url.Parse(strings.TrimSpace(link.AttrOr("href", "")))
+			if err != nil {
+				return
+			}
+			candidate := finalURL.ResolveReference(ref).String()
+			if seen[candidate] {
+				return
+			}
+			seen[candidate] = true
+
+			if feed, ok := probeFeed(ctx, candidate, strings.TrimSpace(link.AttrOr("title", "")), "link"); ok {
+				found = append(found, feed)
+			}
+		})
+	}
+
+	if len(found) > 0 {
+		return found, nil
+	}
+
+	root := &url.URL{Scheme: finalURL.Scheme, Host: finalURL.Host}
+	for _, path := range commonFeedPaths {
+		if ctx.Err() != nil {
+			break
+		}
+		candidate := root.ResolveReference(&url.URL{Path: path}).String()
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+
+		if feed, ok := probeFeed(ctx, candidate, "", "probe"); ok {
+			found = append(found, feed)
+		}
+	}
+
+	return found, nil
+}
+
+// probeFeed fetches and parses candidate and describes it when it is a feed.
+// The feed's own title wins over fallbackTitle.
+func probeFeed(ctx context.Context, candidate string, fallbackTitle string, source string) (DiscoveredFeed, bool) {
+	body, finalURL, err := downloadURL(ctx, candidate, maxDiscoveryPageBytes)
+	if err != nil {
+		return DiscoveredFeed{}, false
+	}
+
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return DiscoveredFeed{}, false
+	}
+
+	title := strings.TrimSpace(feed.Title)
+	if title == "" {
+		title = fallbackTitle
+	}
+
+	return DiscoveredFeed{
+		URL:    finalURL.String(),
+		Title:  title,
+		Type:   feed.FeedType,
+		Source: source,
+	}, true
+}
+
+// downloadURL fetches rawURL and returns its body and the URL it was finally
+// served from after redirects. Bodies larger than maxBytes are an error.
+func downloadURL(ctx context.Context, rawURL string, maxBytes int64) ([]byte, *url.URL, error) {
+	return downloadFeedURL(ctx, &models.Feed{URL: rawURL}, maxBytes)
+}
+
+// downloadFeedURL fetches the URL of feed with its custom headers and
+// credentials and returns at most maxBytes of its body and the URL it was
+// finally served from after redirects. Larger bodies are an error.
+func downloadFeedURL(ctx context.Context, feed *models.Feed, maxBytes int64) ([]byte, *url.URL, error) {
+	req, err := newFeedRequest(ctx, feed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, _ := sharedFetchClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := readLimitedBody(resp.Body, maxBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, resp.Request.URL, nil
+}
+
+// hasToken reports whether the space separated list contains token.
+func hasToken(list string, token string) bool {
+	for _, field := range strings.Fields(strings.ToLower(list)) {
+		if field == token {
+			return true
+		}
+	}
+	return false
+}
@@ -2,113 +2,186 @@ package services
 
 import (
 	"context"
-	"errors"
 	"log"
+	"sync"
 	"time"
 
-	"github.com/mmcdole/gofeed"
 	"github.com/robfig/cron/v3"
 	"gorm.io/gorm"
 
+	"github.com/FarrelioGustiana/backend/config"
 	"github.com/FarrelioGustiana/backend/models"
 )
 
-func StartFeedScheduler(db *gorm.DB) {
+const (
+	// DefaultFetchIntervalMinutes is used for feeds that have no interval configured.
+	DefaultFetchIntervalMinutes = 15
+	// MinFetchIntervalMinutes and MaxFetchIntervalMinutes bound both the admin
+	// configured interval and the adaptive interval computed by the scheduler.
+	MinFetchIntervalMinutes = 5
+	MaxFetchIntervalMinutes = 24 * 60
+
+	// busyFeedThreshold is the number of new articles in a single fetch above
+	// which a feed is considered busy and gets polled more often.
+	busyFeedThreshold = 5
+)
+
+var (
+	feedFetcherMu sync.Mutex
+	feedFetcher   *FeedFetcher
+)
+
+// getFeedFetcher returns the process wide feed fetcher, creating it from the
+// environment on first use. The scheduler and the on-demand refresh endpoints
+// share it, but only the scheduler starts its workers: refreshes fetch on
+// their own goroutine, so API instances never run a worker pool. Feed locks
+// keep a feed from being fetched twice at once across processes.
+func getFeedFetcher() *FeedFetcher {
+	feedFetcherMu.Lock()
+	defer feedFetcherMu.Unlock()
+
+	if feedFetcher == nil {
+		feedFetcher = NewFeedFetcher(config.DB, FeedFetcherConfig{
+			Workers:           config.GetEnvInt("FETCH_WORKERS", 10),
+			PerHostLimit:      config.GetEnvInt("FETCH_PER_HOST_LIMIT", 2),
+			MaxFailures:       config.GetEnvInt("FEED_MAX_FAILURES", 10),
+			RedirectThreshold: config.GetEnvInt("FEED_REDIRECT_THRESHOLD", DefaultRedirectThreshold),
+			ExtractWorkers:    config.GetEnvInt("FETCH_EXTRACT_WORKERS", 2),
+		})
+	}
+	return feedFetcher
+}
+
+// existingFeedFetcher returns the feed fetcher if this process created one,
+// or nil otherwise.
+func existingFeedFetcher() *FeedFetcher {
+	feedFetcherMu.Lock()
+	defer feedFetcherMu.Unlock()
+
+	return feedFetcher
+}
+
+// runningFeedFetcher returns the feed fetcher if this process started its
+// workers, or nil otherwise. Feeds queued on a fetcher without workers would
+// never be fetched.
+func runningFeedFetcher() *FeedFetcher {
+	fetcher := existingFeedFetcher()
+	if fetcher == nil || !fetcher.isStarted() {
+		return nil
+	}
+	return fetcher
+}
+
+// ShutdownFeedFetcher stops the feed fetcher if one was created, waiting for
+// running fetches until ctx expires.
+func ShutdownFeedFetcher(ctx context.Context) error {
+	fetcher := existingFeedFetcher()
+	if fetcher == nil {
+		return nil
+	}
+	return fetcher.Shutdown(ctx)
+}
+
+// FeedScheduler periodically queues due feeds on the feed fetcher.
+type FeedScheduler struct {
+	cron *cron.Cron
+}
+
+// Stop stops queueing new fetches and waits until ctx expires for a running
+// scheduler job to return. It does not stop the fetcher itself, see
+// ShutdownFeedFetcher.
+func (s *FeedScheduler) Stop(ctx context.Context) error {
+	select {
+	case <-s.cron.Stop().Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func StartFeedScheduler(db *gorm.DB) *FeedScheduler {
+	fetcher := getFeedFetcher()
+	fetcher.Start()
+
 	c := cron.New()
 
-	_, err := c.AddFunc("@every 15m", func() {
-		log.Println("Running scheduled feed fetch job...")
-		fetchAndStoreArticles(db)
+	// The job runs every minute but only picks up feeds whose NextFetchAt is due.
+	_, err := c.AddFunc("@every 1m", func() {
+		enqueueDueFeeds(db, fetcher)
 	})
-	
+
 	if err != nil {
 		log.Fatalf("Error scheduling feed fetch job: %v", err)
 	}
 
 	c.Start()
-	log.Println("Feed fetching scheduler started.")
-	
+	log.Printf("Feed fetching scheduler started with %d workers.", fetcher.config.Workers)
+
 	// Run immediately on startup
 	log.Println("Running initial feed fetch job...")
-	go fetchAndStoreArticles(db)
-}
+	go enqueueDueFeeds(db, fetcher)
+
+	go func() {
+		if err := sanitizeStoredArticles(db); err != nil {
+			log.Printf("Error sanitizing stored articles: %v", err)
+		}
+	}()
 
-func fetchAndStoreArticles(db *gorm.DB) {
+	return &FeedScheduler{cron: c}
+}
 
+// enqueueDueFeeds hands every enabled feed whose NextFetchAt has passed to the
+// fetcher. Feeds that are still being fetched from a previous run are skipped.
+func enqueueDueFeeds(db *gorm.DB, fetcher *FeedFetcher) {
 	var feeds []models.Feed
-	if err := db.Find(&feeds).Error; err != nil {
+	if err := db.Where("disabled = ?", false).
+		Where("next_fetch_at IS NULL OR next_fetch_at <= ?", time.Now()).Find(&feeds).Error; err != nil {
 		log.Printf("Error fetching feeds for scheduler: %v", err)
 		return
 	}
 
-	fp := gofeed.NewParser()
-
+	queued := 0
 	for _, feed := range feeds {
+		if fetcher.Enqueue(feed) {
+			queued++
+		}
+	}
 
-		func(feed models.Feed) {
-			go func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Printf("Recovered from panic while fetching feed %s: %v", feed.URL, r)
-					}
-				}()
-
-				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-				defer cancel()
-
-				rssFeed, err := fp.ParseURLWithContext(feed.URL, ctx)
-				if err != nil {
-					log.Printf("Error parsing feed %s (%s): %v", feed.Name, feed.URL, err)
-					return
-				}
-				log.Printf("Fetched feed: %s (%s)", rssFeed.Title, feed.URL)
-
-				for _, item := range rssFeed.Items {
-					articleLink := item.Link
-					guid := item.GUID
-
-					if articleLink == "" && guid == "" {
-						log.Printf("Skipping article from %s due to missing link/guid.", feed.URL)
-						continue
-					}
-
-					if guid == "" {
-						guid = articleLink
-					}
-
-					var existingArticle models.Article
-					if err := db.Where("link = ? OR guid = ?", articleLink, guid).First(&existingArticle).Error; err == nil {
-						continue
-					} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-						log.Printf("Database error checking existing article for feed %s: %v", feed.URL, err)
-						continue
-					}
-
-					pubDate := time.Now()
-					if item.PublishedParsed != nil {
-						pubDate = *item.PublishedParsed
-					}
-
-					article := models.Article{
-						FeedID:      feed.ID,
-						Title:       item.Title,
-						Link:        articleLink,
-						Description: item.Description,
-						PubDate:     &pubDate,
-						GUID:        guid,
-					}
-
-					if err := db.Create(&article).Error; err != nil {
-						log.Printf("Error storing article '%s' from feed %s: %v", item.Title, feed.URL, err)
-					} else {
-						log.Printf("Stored new article: %s", item.Title)
-					}
-				}
-				now := time.Now()
-				feed.LastFetchedAt = &now
-				db.Save(&feed)
-			}()
-
-		}(feed)
+	if queued > 0 {
+		log.Printf("Queued %d due feed(s) for fetching.", queued)
 	}
 }
+
+// scheduleNextFetch adapts the polling interval of a feed to how much it
+// published in the last fetch and sets NextFetchAt accordingly. Busy feeds are
+// polled up to four times as often as their configured interval, quiet feeds
+// back off to at most four times the configured interval.
+func scheduleNextFetch(feed *models.Feed, newArticles int) {
+	base := feed.FetchIntervalMinutes
+	if base <= 0 {
+		base = DefaultFetchIntervalMinutes
+	}
+
+	current := feed.AdaptiveIntervalMinutes
+	if current <= 0 {
+		current = base
+	}
+
+	switch {
+	case newArticles >= busyFeedThreshold:
+		current /= 2
+	case newArticles > 0:
+		// Moderately active feeds drift back towards the configured interval.
+		current = (current + base) / 2
+	default:
+		current += current / 2
+	}
+
+	lower := max(base/4, MinFetchIntervalMinutes)
+	upper := min(base*4, MaxFetchIntervalMinutes)
+	current = min(max(current, lower), upper)
+
+	next := time.Now().Add(time.Duration(current) * time.Minute)
+	feed.AdaptiveIntervalMinutes = current
+	feed.NextFetchAt = &next
+}
@@ -0,0 +1,712 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+
+	"github.com/FarrelioGustiana/backend/models"
+	"github.com/FarrelioGustiana/backend/utils"
+)
+
+// FeedFetcher fetches feeds on a bounded pool of workers. It limits how many
+// requests run against the same host at once and makes sure a feed is never
+// fetched by two workers at the same time.
+type FeedFetcher struct {
+	db     *gorm.DB
+	client *http.Client
+	jobs   chan models.Feed
+	config FeedFetcherConfig
+
+	// ctx is shared by all fetches and cancelled when a shutdown times out.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	started   bool
+	closed    bool
+	inFlight  map[uint]struct{}
+	hostSlots map[string]chan struct{}
+	// hostWaiting holds the claimed feeds that found their host saturated.
+	// They are handed to whoever frees a slot of the host, so workers never
+	// block on a busy host while other hosts are due.
+	hostWaiting map[string][]models.Feed
+
+	// extractions queues new articles of FetchFullContent feeds for their
+	// pages to be downloaded, off the feed workers.
+	extractions      chan models.Article
+	extractWG        sync.WaitGroup
+	extractStartOnce sync.Once
+	extractCloseOnce sync.Once
+}
+
+var (
+	// ErrFeedFetchInProgress is returned when a feed is already being fetched.
+	ErrFeedFetchInProgress = errors.New("feed is already being fetched")
+	// ErrFeedFetchFailed wraps errors from fetching or parsing a feed.
+	ErrFeedFetchFailed = errors.New("failed to fetch feed")
+	// ErrFeedFetcherStopped is returned once the fetcher is shutting down.
+	ErrFeedFetcherStopped = errors.New("feed fetcher is shutting down")
+)
+
+// FeedFetcherConfig holds the tunables of a FeedFetcher.
+type FeedFetcherConfig struct {
+	// Workers is the number of feeds fetched concurrently.
+	Workers int
+	// PerHostLimit is the number of concurrent requests allowed to one host.
+	PerHostLimit int
+	// MaxFailures is the number of consecutive failures after which a feed
+	// is disabled. Zero never disables feeds.
+	MaxFailures int
+	// MaxBodyBytes is the largest feed accepted, the FETCH_MAX_BODY_BYTES
+	// setting when zero.
+	MaxBodyBytes int64
+	// RedirectThreshold is the number of consecutive fetches permanently
+	// redirected to the same URL after which the feed URL is updated. Zero
+	// never updates feed URLs.
+	RedirectThreshold int
+	// ExtractWorkers is the number of article pages downloaded concurrently
+	// for feeds with FetchFullContent.
+	ExtractWorkers int
+}
+
+// fetchResult describes the outcome of fetching a single feed.
+type fetchResult struct {
+	HTTPStatus      int
+	BytesDownloaded int64
+	ItemsSeen       int
+	NewArticles     int
+	UpdatedArticles int
+	// PermanentRedirect is the URL the feed was permanently redirected to,
+	// empty when it was served without redirects or redirected temporarily.
+	PermanentRedirect string
+}
+
+// maxQueuedExtractions is the number of articles that may wait for their
+// page to be downloaded.
+const maxQueuedExtractions = 256
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// NewFeedFetcher creates a fetcher from cfg. Call Start to launch the workers.
+func NewFeedFetcher(db *gorm.DB, cfg FeedFetcherConfig) *FeedFetcher {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.PerHostLimit < 1 {
+		cfg.PerHostLimit = 1
+	}
+	if cfg.ExtractWorkers < 1 {
+		cfg.ExtractWorkers = 1
+	}
+
+	client, fetchConfig := sharedFetchClient()
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = fetchConfig.MaxBodyBytes
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &FeedFetcher{
+		db:        db,
+		client:    client,
+		jobs:      make(chan models.Feed, cfg.Workers*4),
+		config:    cfg,
+		ctx:       ctx,
+		cancel:    cancel,
+		inFlight:  make(map[uint]struct{}),
+		hostSlots: make(map[string]chan struct{}),
+
+		hostWaiting: make(map[string][]models.Feed),
+
+		extractions: make(chan models.Article, maxQueuedExtractions),
+	}
+}
+
+// Start launches the worker goroutines.
+func (f *FeedFetcher) Start() {
+	f.mu.Lock()
+	f.started = true
+	f.mu.Unlock()
+
+	f.wg.Add(f.config.Workers)
+	for i := 0; i < f.config.Workers; i++ {
+		go func() {
+			defer f.wg.Done()
+			f.worker()
+		}()
+	}
+}
+
+// Shutdown stops accepting new fetches, drops queued ones and waits for the
+// running fetches to finish. When ctx expires first, the running fetches are
+// cancelled and ctx's error is returned.
+func (f *FeedFetcher) Shutdown(ctx context.Context) error {
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.jobs)
+	}
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		// Only fetches queue extractions, so none can be added anymore.
+		f.extractCloseOnce.Do(func() { close(f.extractions) })
+		f.extractWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		f.cancel()
+		return nil
+	case <-ctx.Done():
+		log.Println("Timed out waiting for feed fetches, cancelling them...")
+		f.cancel()
+		// Give the cancelled fetches a moment to record their state.
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+		return ctx.Err()
+	}
+}
+
+// Enqueue queues a feed for fetching. It returns false when the feed is
+// already queued or being fetched, when the queue is full or when the
+// fetcher is shutting down.
+func (f *FeedFetcher) Enqueue(feed models.Feed) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return false
+	}
+	if _, busy := f.inFlight[feed.ID]; busy {
+		return false
+	}
+
+	select {
+	case f.jobs <- feed:
+		f.inFlight[feed.ID] = struct{}{}
+		return true
+	default:
+		log.Printf("Feed fetch queue is full, skipping feed %s until the next run", feed.URL)
+		return false
+	}
+}
+
+// claim marks a feed as being fetched outside of the worker pool.
+func (f *FeedFetcher) claim(feedID uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrFeedFetcherStopped
+	}
+	if _, busy := f.inFlight[feedID]; busy {
+		return ErrFeedFetchInProgress
+	}
+	f.inFlight[feedID] = struct{}{}
+	f.wg.Add(1)
+	return nil
+}
+
+func (f *FeedFetcher) release(feedID uint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.inFlight, feedID)
+}
+
+func (f *FeedFetcher) isStarted() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.started
+}
+
+func (f *FeedFetcher) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.closed
+}
+
+// hostSlotLocked returns the semaphore that limits concurrent requests to
+// host. f.mu must be held.
+func (f *FeedFetcher) hostSlotLocked(host string) chan struct{} {
+	slot, ok := f.hostSlots[host]
+	if !ok {
+		slot = make(chan struct{}, f.config.PerHostLimit)
+		f.hostSlots[host] = slot
+	}
+	return slot
+}
+
+// waitHostSlot blocks until a slot of host is free and takes it. Release it
+// with freeHostSlot.
+func (f *FeedFetcher) waitHostSlot(host string) error {
+	f.mu.Lock()
+	slot := f.hostSlotLocked(host)
+	f.mu.Unlock()
+
+	select {
+	case slot <- struct{}{}:
+		return nil
+	case <-f.ctx.Done():
+		return ErrFeedFetcherStopped
+	}
+}
+
+// tryHostSlot takes a slot of host for a claimed feed. When the host is
+// saturated the feed waits in hostWaiting, still claimed, and false is
+// returned.
+func (f *FeedFetcher) tryHostSlot(host string, feed models.Feed) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	select {
+	case f.hostSlotLocked(host) <- struct{}{}:
+		return true
+	default:
+		f.hostWaiting[host] = append(f.hostWaiting[host], feed)
+		return false
+	}
+}
+
+// releaseHostSlot gives up a slot of host. When a feed waits for the host, the
+// slot is passed on to it instead: the feed is returned, counted in f.wg, and
+// the caller must fetch it and call f.wg.Done. Waiting feeds are dropped on
+// shutdown.
+func (f *FeedFetcher) releaseHostSlot(host string) (models.Feed, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	waiting := f.hostWaiting[host]
+	if len(waiting) > 0 && !f.closed {
+		next := waiting[0]
+		if len(waiting) == 1 {
+			delete(f.hostWaiting, host)
+		} else {
+			f.hostWaiting[host] = waiting[1:]
+		}
+		f.wg.Add(1)
+		return next, true
+	}
+
+	for _, feed := range waiting {
+		delete(f.inFlight, feed.ID)
+	}
+	delete(f.hostWaiting, host)
+	<-f.hostSlots[host]
+	return models.Feed{}, false
+}
+
+// freeHostSlot releases a slot taken outside the feed workers. A feed waiting
+// for the host is fetched on a goroutine of its own, so the caller does not
+// wait for it.
+func (f *FeedFetcher) freeHostSlot(host string) {
+	next, ok := f.releaseHostSlot(host)
+	if !ok {
+		return
+	}
+	go func() {
+		defer f.wg.Done()
+		f.processOnHost(gofeed.NewParser(), host, next)
+	}()
+}
+
+// processOnHost fetches feed on the slot of host the caller holds, then the
+// feeds handed the slot while it was busy, and finally releases the slot.
+func (f *FeedFetcher) processOnHost(fp *gofeed.Parser, host string, feed models.Feed) {
+	f.process(fp, feed)
+	for {
+		next, ok := f.releaseHostSlot(host)
+		if !ok {
+			return
+		}
+		f.process(fp, next)
+		f.wg.Done()
+	}
+}
+
+func (f *FeedFetcher) worker() {
+	// gofeed.Parser is not safe for concurrent use, so every worker owns one.
+	fp := gofeed.NewParser()
+
+	for feed := range f.jobs {
+		// Queued feeds are dropped on shutdown, the scheduler picks them up
+		// again after the restart.
+		if f.isClosed() {
+			f.release(feed.ID)
+			continue
+		}
+		host := feedHost(feed.URL)
+		if !f.tryHostSlot(host, feed) {
+			continue
+		}
+		f.processOnHost(fp, host, feed)
+	}
+}
+
+// FetchNow fetches a feed synchronously on the calling goroutine and returns
+// the number of new articles stored. It returns ErrFeedFetchInProgress when
+// the feed is already queued or being fetched, by this or another process.
+func (f *FeedFetcher) FetchNow(feed models.Feed) (int, error) {
+	if err := f.claim(feed.ID); err != nil {
+		return 0, err
+	}
+	defer f.wg.Done()
+
+	host := feedHost(feed.URL)
+	if err := f.waitHostSlot(host); err != nil {
+		f.release(feed.ID)
+		return 0, err
+	}
+	result, err := f.process(gofeed.NewParser(), feed)
+	f.freeHostSlot(host)
+	if errors.Is(err, ErrFeedFetchInProgress) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrFeedFetchFailed, err)
+	}
+	return result.NewArticles, nil
+}
+
+// process fetches a claimed feed, records the outcome and releases the claim.
+// The caller holds a slot of the feed's host.
+func (f *FeedFetcher) process(fp *gofeed.Parser, feed models.Feed) (result fetchResult, err error) {
+	defer f.release(feed.ID)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic while fetching feed %s: %v", feed.URL, r)
+			err = fmt.Errorf("panic while fetching feed: %v", r)
+		}
+	}()
+
+	unlock, err := acquireFeedLock(f.ctx, f.db, feed.ID)
+	if err != nil {
+		if !errors.Is(err, ErrFeedFetchInProgress) {
+			log.Printf("Error locking feed %s: %v", feed.URL, err)
+		}
+		return result, err
+	}
+	defer unlock()
+
+	queuedURL := feed.URL
+	startedAt := time.Now()
+	result, err = f.fetch(fp, &feed)
+	f.recordFetch(feed.ID, startedAt, result, err)
+
+	// A fetch aborted by shutdown says nothing about the health of the feed.
+	if err != nil && f.ctx.Err() != nil {
+		log.Printf("Fetch of feed %s was cancelled by shutdown", feed.URL)
+		return result, err
+	}
+
+	switch {
+	case errors.Is(err, ErrFeedGone):
+		markFeedGone(&feed, err)
+	case err != nil:
+		log.Printf("Error fetching feed %s (%s): %v", feed.Name, feed.URL, err)
+		recordFetchFailure(&feed, result.HTTPStatus, err, f.config.MaxFailures)
+	default:
+		recordFetchSuccess(&feed, result.HTTPStatus)
+		scheduleNextFetch(&feed, result.NewArticles)
+
+		if err := trackPermanentRedirect(f.db, &feed, result.PermanentRedirect, f.config.RedirectThreshold); err != nil {
+			log.Printf("Error following permanent redirect of feed %s: %v", feed.URL, err)
+		}
+
+		if feedIconStale(&feed) {
+			if err := refreshFeedIcon(f.ctx, f.db, &feed); err != nil {
+				log.Printf("Error resolving favicon of feed %s: %v", feed.URL, err)
+			}
+		}
+	}
+
+	if saveErr := f.saveFetchState(&feed, queuedURL); saveErr != nil {
+		log.Printf("Error saving fetch state for feed %s: %v", feed.URL, saveErr)
+	}
+
+	return result, err
+}
+
+// fetch downloads and parses a single feed and stores its new articles.
+// It updates the fetch related fields on feed but does not persist them.
+func (f *FeedFetcher) fetch(fp *gofeed.Parser, feed *models.Feed) (fetchResult, error) {
+	var result fetchResult
+
+	trace := &redirectTrace{}
+	req, err := newFeedRequest(withRedirectTrace(f.ctx, trace), feed)
+	if err != nil {
+		return result, err
+	}
+	// Conditional headers let the publisher answer with 304 when nothing changed.
+	if feed.ETag != "" {
+		req.Header.Set("If-None-Match", feed.ETag)
+	}
+	if feed.LastModified != "" {
+		req.Header.Set("If-Modified-Since", feed.LastModified)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return result, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result.HTTPStatus = resp.StatusCode
+	if !trace.broken {
+		result.PermanentRedirect = trace.permanentURL
+	}
+
+	now := time.Now()
+
+	if resp.StatusCode == http.StatusNotModified {
+		log.Printf("Feed not modified since last fetch: %s (%s)", feed.Name, feed.URL)
+		feed.LastFetchedAt = &now
+		return result, nil
+	}
+
+	if resp.StatusCode == http.StatusGone {
+		return result, ErrFeedGone
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body := &countingReader{reader: resp.Body}
+	data, err := readLimitedBody(body, f.config.MaxBodyBytes)
+	result.BytesDownloaded = body.count
+	if err != nil {
+		return result, fmt.Errorf("failed to read feed: %w", err)
+	}
+
+	rssFeed, err := fp.Parse(bytes.NewReader(data))
+	if err != nil {
+		return result, fmt.Errorf("failed to parse feed: %w", err)
+	}
+	log.Printf("Fetched feed: %s (%s)", rssFeed.Title, feed.URL)
+	applyFeedMetadata(feed, rssFeed)
+
+	result.ItemsSeen = len(rssFeed.Items)
+
+	for _, item := range rssFeed.Items {
+		article := buildArticle(feed, item)
+		if article.DedupKey == "" {
+			log.Printf("Skipping article from %s due to missing link/guid.", feed.URL)
+			continue
+		}
+
+		existingArticle, err := findExistingArticle(f.db, &article)
+		if err == nil {
+			updated, err := updateArticle(f.db, existingArticle, article)
+			if err != nil {
+				log.Printf("Error updating article '%s' from feed %s: %v", item.Title, feed.URL, err)
+			} else if updated {
+				log.Printf("Updated changed article: %s", item.Title)
+				result.UpdatedArticles++
+			}
+			continue
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Database error checking existing article for feed %s: %v", feed.URL, err)
+			continue
+		}
+
+		if err := linkDuplicateStory(f.db, &article); err != nil {
+			log.Printf("Database error checking duplicate stories for feed %s: %v", feed.URL, err)
+		}
+
+		if err := f.db.Create(&article).Error; err != nil {
+			log.Printf("Error storing article '%s' from feed %s: %v", item.Title, feed.URL, err)
+		} else {
+			log.Printf("Stored new article: %s", item.Title)
+			result.NewArticles++
+
+			if err := assignStoryCluster(f.db, &article); err != nil {
+				log.Printf("Error clustering article '%s' from feed %s: %v", item.Title, feed.URL, err)
+			}
+
+			if feed.FetchFullContent && article.Link != "" {
+				f.queueExtraction(article)
+			}
+		}
+	}
+
+	feed.LastFetchedAt = &now
+	feed.ETag = resp.Header.Get("ETag")
+	feed.LastModified = resp.Header.Get("Last-Modified")
+
+	return result, nil
+}
+
+// queueExtraction hands article to the extraction workers, starting them on
+// first use. When the queue is full the article keeps its feed content.
+func (f *FeedFetcher) queueExtraction(article models.Article) {
+	f.extractStartOnce.Do(func() {
+		f.extractWG.Add(f.config.ExtractWorkers)
+		for i := 0; i < f.config.ExtractWorkers; i++ {
+			go func() {
+				defer f.extractWG.Done()
+				f.extractWorker()
+			}()
+		}
+	})
+
+	select {
+	case f.extractions <- article:
+	default:
+		log.Printf("Content extraction queue is full, keeping the feed content of %s", article.Link)
+	}
+}
+
+// extractWorker downloads the pages of queued articles. Article pages often
+// live on another host than their feed, so they take a slot of their own
+// host.
+func (f *FeedFetcher) extractWorker() {
+	for article := range f.extractions {
+		if f.ctx.Err() != nil {
+			continue
+		}
+
+		host := feedHost(article.Link)
+		if err := f.waitHostSlot(host); err != nil {
+			continue
+		}
+		f.storeExtractedContent(&article)
+		f.freeHostSlot(host)
+	}
+}
+
+// storeExtractedContent downloads the page of article and stores its main
+// content. Failures are logged, the article keeps its feed content.
+func (f *FeedFetcher) storeExtractedContent(article *models.Article) {
+	extracted, err := extractArticleContent(f.ctx, f.client, article.Link)
+	if err != nil {
+		log.Printf("Error extracting full content of %s: %v", article.Link, err)
+		return
+	}
+
+	now := time.Now()
+	article.ExtractedContent = utils.SanitizeHTML(extracted.HTML)
+	article.ExtractedText = extracted.Text
+	article.ExtractedAt = &now
+
+	err = f.db.Model(article).Updates(map[string]interface{}{
+		"extracted_content": article.ExtractedContent,
+		"extracted_text":    article.ExtractedText,
+		"extracted_at":      article.ExtractedAt,
+	}).Error
+	if err != nil {
+		log.Printf("Error storing extracted content of %s: %v", article.Link, err)
+	}
+}
+
+// saveFetchState persists the fields of feed the fetcher owns. feed is the
+// copy taken when it was queued, so everything else may have been changed by
+// an admin in the meantime and is left alone. A feed deleted while it was
+// being fetched stays deleted.
+func (f *FeedFetcher) saveFetchState(feed *models.Feed, queuedURL string) error {
+	updates := map[string]interface{}{
+		"last_fetched_at":           feed.LastFetchedAt,
+		"etag":                      feed.ETag,
+		"last_modified":             feed.LastModified,
+		"title":                     feed.Title,
+		"description":               feed.Description,
+		"site_url":                  feed.SiteURL,
+		"language":                  feed.Language,
+		"image_url":                 feed.ImageURL,
+		"feed_updated_at":           feed.FeedUpdatedAt,
+		"icon_url":                  feed.IconURL,
+		"icon_source_url":           feed.IconSourceURL,
+		"icon_fetched_at":           feed.IconFetchedAt,
+		"adaptive_interval_minutes": feed.AdaptiveIntervalMinutes,
+		"next_fetch_at":             feed.NextFetchAt,
+		"last_success_at":           feed.LastSuccessAt,
+		"last_error":                feed.LastError,
+		"last_http_status":          feed.LastHTTPStatus,
+		"consecutive_failures":      feed.ConsecutiveFailures,
+		"redirect_url":              feed.RedirectURL,
+		"redirect_count":            feed.RedirectCount,
+	}
+	// Only a permanent redirect moves the feed, see trackPermanentRedirect.
+	if feed.URL != queuedURL {
+		updates["url"] = feed.URL
+	}
+	// Enabling a feed is up to admins, the fetcher only ever disables it.
+	if feed.Disabled {
+		updates["disabled"] = true
+		updates["disabled_at"] = feed.DisabledAt
+		updates["disabled_reason"] = feed.DisabledReason
+	}
+
+	result := f.db.Model(&models.Feed{}).
+		Where("id = ? AND deleted_at IS NULL", feed.ID).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("Feed %d was deleted while it was being fetched, discarding its fetch state", feed.ID)
+	}
+	return nil
+}
+
+// recordFetch stores the history entry for one fetch of a feed.
+func (f *FeedFetcher) recordFetch(feedID uint, startedAt time.Time, result fetchResult, fetchErr error) {
+	fetch := models.FeedFetch{
+		FeedID:           feedID,
+		StartedAt:        startedAt,
+		FinishedAt:       time.Now(),
+		HTTPStatus:       result.HTTPStatus,
+		BytesDownloaded:  result.BytesDownloaded,
+		ItemsSeen:        result.ItemsSeen,
+		ArticlesInserted: result.NewArticles,
+		ArticlesUpdated:  result.UpdatedArticles,
+	}
+	if fetchErr != nil {
+		fetch.Error = fetchErr.Error()
+	}
+
+	if err := f.db.Create(&fetch).Error; err != nil {
+		log.Printf("Error storing fetch history for feed %d: %v", feedID, err)
+	}
+}
+
+// feedHost returns the lower-cased host of rawURL, used as the key for
+// per-host concurrency limits.
+func feedHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+	return strings.ToLower(parsed.Hostname())
+}
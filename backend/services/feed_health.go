@@ -0,0 +1,51 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+// recordFetchSuccess clears the failure state of a feed after a successful fetch.
+func recordFetchSuccess(feed *models.Feed, httpStatus int) {
+	now := time.Now()
+	feed.LastSuccessAt = &now
+	feed.LastHTTPStatus = httpStatus
+	feed.LastError = ""
+	feed.ConsecutiveFailures = 0
+}
+
+// recordFetchFailure stores the error of a failed fetch and backs the feed off
+// exponentially: every consecutive failure doubles the wait before the next
+// attempt, up to MaxFetchIntervalMinutes. Once maxFailures is reached the feed
+// is disabled and no longer picked up by the scheduler.
+func recordFetchFailure(feed *models.Feed, httpStatus int, fetchErr error, maxFailures int) {
+	now := time.Now()
+	feed.LastFetchedAt = &now
+	feed.LastHTTPStatus = httpStatus
+	feed.LastError = fetchErr.Error()
+	feed.ConsecutiveFailures++
+
+	if maxFailures > 0 && feed.ConsecutiveFailures >= maxFailures {
+		feed.Disabled = true
+		feed.DisabledAt = &now
+		feed.DisabledReason = disabledReasonFailures
+		log.Printf("Disabling feed %s after %d consecutive failures", feed.URL, feed.ConsecutiveFailures)
+		return
+	}
+
+	base := feed.FetchIntervalMinutes
+	if base <= 0 {
+		base = DefaultFetchIntervalMinutes
+	}
+
+	backoff := base
+	for i := 1; i < feed.ConsecutiveFailures && backoff < MaxFetchIntervalMinutes; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, MaxFetchIntervalMinutes)
+
+	next := now.Add(time.Duration(backoff) * time.Minute)
+	feed.NextFetchAt = &next
+}
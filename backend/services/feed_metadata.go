@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/FarrelioGustiana/backend/config"
+	"github.com/FarrelioGustiana/backend/models"
+	"github.com/FarrelioGustiana/backend/utils"
+)
+
+const (
+	// maxIconBytes caps the size of a downloaded favicon.
+	maxIconBytes = 512 << 10
+	// iconRefreshInterval is how long a cached favicon is kept before it is
+	// resolved again.
+	iconRefreshInterval = 7 * 24 * time.Hour
+	// IconRoutePrefix is the URL path under which cached favicons are served.
+	IconRoutePrefix = "/icons"
+)
+
+// iconContentTypes are the sniffed content types accepted as favicons. SVG
+// is left out on purpose, it can carry scripts and icons are served from our
+// own origin.
+var iconContentTypes = map[string]bool{
+	"image/x-icon":             true,
+	"image/vnd.microsoft.icon": true,
+	"image/png":                true,
+	"image/gif":                true,
+	"image/jpeg":               true,
+	"image/webp":               true,
+	"image/bmp":                true,
+}
+
+// applyFeedMetadata copies the metadata published by a parsed feed to feed.
+func applyFeedMetadata(feed *models.Feed, parsed *gofeed.Feed) {
+	feed.Title = truncate(utils.HTMLToText(parsed.Title), 255)
+	feed.Description = utils.HTMLToText(parsed.Description)
+	feed.Language = truncate(strings.TrimSpace(parsed.Language), 255)
+	feed.SiteURL = truncate(resolveFeedURL(feed.URL, parsed.Link), 1000)
+
+	feed.ImageURL = ""
+	if parsed.Image != nil {
+		feed.ImageURL = truncate(resolveFeedURL(feed.URL, parsed.Image.URL), 1000)
+	}
+
+	feed.FeedUpdatedAt = parsed.UpdatedParsed
+	if feed.FeedUpdatedAt == nil {
+		feed.FeedUpdatedAt = parsed.PublishedParsed
+	}
+}
+
+// resolveFeedURL resolves a possibly relative URL found in a feed against
+// the feed URL. Empty and unparseable values resolve to an empty string.
+func resolveFeedURL(feedURL string, rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+	ref, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	base, err := url.Parse(feedURL)
+	if err != nil {
+		return ref.String()
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// feedIconStale reports whether the favicon of feed should be resolved again.
+func feedIconStale(feed *models.Feed) bool {
+	return feed.IconFetchedAt == nil || time.Since(*feed.IconFetchedAt) > iconRefreshInterval
+}
+
+// refreshFeedIcon resolves the favicon of the site of feed, caches it in the
+// database and points feed.IconURL at the cached copy. The attempt is recorded
+// in IconFetchedAt even when it fails, so broken sites are not retried on
+// every fetch.
+func refreshFeedIcon(ctx context.Context, db *gorm.DB, feed *models.Feed) error {
+	now := time.Now()
+	feed.IconFetchedAt = &now
+
+	site := feed.SiteURL
+	if site == "" {
+		site = feed.URL
+	}
+	siteURL, err := url.Parse(site)
+	if err != nil || siteURL.Host == "" {
+		return fmt.Errorf("invalid site URL %q", site)
+	}
+
+	for _, candidate := range iconCandidates(ctx, siteURL) {
+		body, _, err := downloadURL(ctx, candidate, maxIconBytes)
+		if err != nil {
+			continue
+		}
+		contentType := http.DetectContentType(body)
+		if !iconContentTypes[contentType] {
+			continue
+		}
+
+		iconURL, err := storeFeedIcon(db, feed.ID, contentType, body)
+		if err != nil {
+			return err
+		}
+
+		feed.IconURL = iconURL
+		feed.IconSourceURL = truncate(candidate, 1000)
+		return nil
+	}
+
+	return errors.New("no usable favicon found")
+}
+
+// iconCandidates lists the favicon URLs of a site in order of preference:
+// the icons declared by its home page, then /favicon.ico.
+func iconCandidates(ctx context.Context, siteURL *url.URL) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	add := func(candidate string) {
+		if candidate != "" && !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	home := &url.URL{Scheme: siteURL.Scheme, Host: siteURL.Host, Path: "/"}
+	if body, finalURL, err := downloadURL(ctx, home.String(), maxDiscoveryPageBytes); err == nil {
+		if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+			var touchIcons []string
+			doc.Find("link[href]").Each(func(_ int, link *goquery.Selection) {
+				rel := link.AttrOr("rel", "")
+				if !hasToken(rel, "icon") && !hasToken(rel, "apple-touch-icon") {
+					return
+				}
+				ref, err := url.Parse(strings.TrimSpace(link.AttrOr("href", "")))
+				if err != nil {
+					return
+				}
+				resolved := finalURL.ResolveReference(ref).String()
+				if hasToken(rel, "apple-touch-icon") {
+					touchIcons = append(touchIcons, resolved)
+					return
+				}
+				add(resolved)
+			})
+			for _, icon := range touchIcons {
+				add(icon)
+			}
+		}
+	}
+
+	add(home.ResolveReference(&url.URL{Path: "/favicon.ico"}).String())
+	return candidates
+}
+
+// storeFeedIcon stores the favicon of a feed and returns the path it is
+// served from. The path changes with the icon, so browsers may cache it.
+func storeFeedIcon(db *gorm.DB, feedID uint, contentType string, data []byte) (string, error) {
+	icon := models.FeedIcon{FeedID: feedID, ContentType: contentType, Data: data}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "feed_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content_type", "data", "updated_at"}),
+	}).Create(&icon).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to store icon: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s/%d?v=%s", IconRoutePrefix, feedID, hex.EncodeToString(sum[:4])), nil
+}
+
+// GetFeedIcon returns the cached favicon of a feed.
+func GetFeedIcon(feedID uint) (*models.FeedIcon, error) {
+	var icon models.FeedIcon
+	if err := config.DB.Where("feed_id = ?", feedID).First(&icon).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("icon not found")
+		}
+		return nil, fmt.Errorf("database error retrieving icon: %w", err)
+	}
+	return &icon, nil
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+var (
+	// ErrFeedUnreachable is returned when a feed URL cannot be downloaded.
+	ErrFeedUnreachable = errors.New("feed URL could not be fetched")
+	// ErrNotAFeed is returned when a URL does not serve an RSS, Atom or JSON feed.
+	ErrNotAFeed = errors.New("URL does not point to a valid RSS, Atom or JSON feed")
+)
+
+// FeedPreviewItem is a parsed feed item that has not been stored.
+type FeedPreviewItem struct {
+	Title       string     `json:"title"`
+	Link        string     `json:"link"`
+	Description string     `json:"description"`
+	Author      string     `json:"author"`
+	ImageURL    string     `json:"imageUrl"`
+	PubDate     *time.Time `json:"pubDate"`
+}
+
+// FeedPreview describes a feed and its first items without storing anything.
+type FeedPreview struct {
+	URL         string            `json:"url"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Link        string            `json:"link"`
+	Type        string            `json:"type"`
+	ItemCount   int               `json:"itemCount"`
+	Items       []FeedPreviewItem `json:"items"`
+}
+
+// parseRemoteFeed downloads and parses the feed at the URL of feed, using its
+// custom headers and credentials. The download is abandoned when ctx is done.
+func parseRemoteFeed(ctx context.Context, feed *models.Feed) (*gofeed.Feed, error) {
+	parsed, err := url.Parse(strings.TrimSpace(feed.URL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.New("invalid URL")
+	}
+
+	_, cfg := sharedFetchClient()
+	body, _, err := downloadFeedURL(ctx, feed, cfg.MaxBodyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFeedUnreachable, err)
+	}
+
+	parsedFeed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, ErrNotAFeed
+	}
+
+	return parsedFeed, nil
+}
+
+// PreviewFeed fetches and parses the feed described by input and returns at
+// most limit of its items, processed the same way as stored articles.
+func PreviewFeed(ctx context.Context, input FeedInput, limit int) (*FeedPreview, error) {
+	feed := &models.Feed{URL: input.URL}
+	if err := applyFeedRequestSettings(feed, input); err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseRemoteFeed(ctx, feed)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &FeedPreview{
+		URL:         feed.URL,
+		Title:       strings.TrimSpace(parsed.Title),
+		Description: strings.TrimSpace(parsed.Description),
+		Link:        parsed.Link,
+		Type:        parsed.FeedType,
+		ItemCount:   len(parsed.Items),
+		Items:       []FeedPreviewItem{},
+	}
+
+	for _, item := range parsed.Items {
+		if len(preview.Items) >= limit {
+			break
+		}
+		if item == nil {
+			continue
+		}
+
+		article := buildArticle(feed, item)
+		preview.Items = append(preview.Items, FeedPreviewItem{
+			Title:       article.Title,
+			Link:        article.Link,
+			Description: article.Description,
+			Author:      article.Author,
+			ImageURL:    article.ImageURL,
+			PubDate:     article.PubDate,
+		})
+	}
+
+	return preview, nil
+}
+
+// feedNameFromTitle picks the name of a new feed from its parsed title,
+// falling back to the host of its URL.
+func feedNameFromTitle(parsed *gofeed.Feed, feedURL string) string {
+	if title := strings.TrimSpace(parsed.Title); title != "" {
+		return title
+	}
+	return feedHost(feedURL)
+}
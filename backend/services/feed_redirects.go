@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+const (
+	// maxRedirects is the number of redirects followed for a single request.
+	maxRedirects = 10
+	// DefaultRedirectThreshold is the number of consecutive fetches that must
+	// be permanently redirected to the same URL before the feed is moved.
+	DefaultRedirectThreshold = 3
+
+	disabledReasonFailures = "failures"
+	disabledReasonGone     = "gone"
+)
+
+// ErrFeedGone is returned when the publisher answers 410 Gone.
+var ErrFeedGone = errors.New("feed is gone (HTTP 410)")
+
+type redirectTraceKey struct{}
+
+// redirectTrace follows the redirects of one request.
+type redirectTrace struct {
+	// permanentURL is the last URL reached through permanent redirects only,
+	// starting at the requested URL. It stays empty when the first redirect
+	// is temporary.
+	permanentURL string
+	// broken is set once a temporary redirect shows up in the chain.
+	broken bool
+}
+
+// withRedirectTrace returns a context that makes the fetch client record the
+// redirects of a request in trace.
+func withRedirectTrace(ctx context.Context, trace *redirectTrace) context.Context {
+	return context.WithValue(ctx, redirectTraceKey{}, trace)
+}
+
+// checkRedirect follows up to maxRedirects redirects and records in the
+// request's redirectTrace whether the chain consists of 301 and 308 only.
+// The client itself only drops Authorization and cookies when a redirect
+// leaves the host; the custom headers and header credentials of the feed
+// are dropped as well, and also on a downgrade to plain HTTP.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	first := via[0].URL
+	if req.URL.Host != first.Host || (first.Scheme == "https" && req.URL.Scheme != "https") {
+		req.Header.Del("Authorization")
+		if private, ok := req.Context().Value(privateHeadersKey{}).([]string); ok {
+			for _, name := range private {
+				req.Header.Del(name)
+			}
+		}
+	}
+
+	trace, ok := req.Context().Value(redirectTraceKey{}).(*redirectTrace)
+	if !ok || trace.broken || req.Response == nil {
+		return nil
+	}
+
+	switch req.Response.StatusCode {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		trace.permanentURL = req.URL.String()
+	default:
+		trace.broken = true
+	}
+	return nil
+}
+
+// trackPermanentRedirect counts consecutive fetches of feed that were
+// permanently redirected to target and moves the feed there once threshold
+// is reached. An empty target resets the count. The change of URL is recorded
+// in the feed's URL history; feed itself is not persisted.
+func trackPermanentRedirect(db *gorm.DB, feed *models.Feed, target string, threshold int) error {
+	if target == "" || target == feed.URL {
+		feed.RedirectURL = ""
+		feed.RedirectCount = 0
+		return nil
+	}
+
+	if target == feed.RedirectURL {
+		feed.RedirectCount++
+	} else {
+		feed.RedirectURL = target
+		feed.RedirectCount = 1
+	}
+
+	if threshold < 1 || feed.RedirectCount < threshold {
+		return nil
+	}
+
+	var taken int64
+	if err := db.Model(&models.Feed{}).Where("id <> ? AND url = ?", feed.ID, target).Count(&taken).Error; err != nil {
+		return fmt.Errorf("failed to check redirect target: %w", err)
+	}
+	if taken > 0 {
+		return fmt.Errorf("redirect target %s is already used by another feed", target)
+	}
+
+	change := models.FeedURLChange{
+		FeedID: feed.ID,
+		OldURL: feed.URL,
+		NewURL: target,
+		Reason: "permanent_redirect",
+	}
+	if err := db.Create(&change).Error; err != nil {
+		return fmt.Errorf("failed to record URL change: %w", err)
+	}
+
+	log.Printf("Feed %d moved permanently from %s to %s", feed.ID, feed.URL, target)
+	feed.URL = target
+	feed.RedirectURL = ""
+	feed.RedirectCount = 0
+	return nil
+}
+
+// markFeedGone disables a feed whose publisher answered 410 Gone. Unlike
+// other failures there is no backoff, the feed is dead right away.
+func markFeedGone(feed *models.Feed, fetchErr error) {
+	recordFetchFailure(feed, http.StatusGone, fetchErr, 0)
+	feed.Disabled = true
+	feed.DisabledAt = feed.LastFetchedAt
+	feed.DisabledReason = disabledReasonGone
+	log.Printf("Disabling feed %s, the publisher answered 410 Gone", feed.URL)
+}
@@ -1,33 +1,95 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/mmcdole/gofeed"
 	"gorm.io/gorm"
 
 	"github.com/FarrelioGustiana/backend/config"
 	"github.com/FarrelioGustiana/backend/models"
 )
 
-func CreateFeed(name string, url string) (*models.Feed, error) {
+// FeedInput holds the admin editable settings of a feed.
+type FeedInput struct {
+	Name                 string
+	URL                  string
+	FetchIntervalMinutes int
+	FetchFullContent     bool
+	// Headers are sent with every request for the feed. Nil keeps the
+	// current headers, an empty map removes them.
+	Headers map[string]string
+	// Auth replaces the credentials of the feed, nil keeps them.
+	Auth *FeedAuthInput
+}
+
+// applyFeedRequestSettings validates the custom headers and credentials of
+// input and copies them to feed.
+func applyFeedRequestSettings(feed *models.Feed, input FeedInput) error {
+	if err := validateFeedHeaders(input.Headers); err != nil {
+		return err
+	}
+
+	if input.Headers != nil {
+		feed.Headers = input.Headers
+	}
+	if input.Auth != nil {
+		return setFeedCredentials(feed, *input.Auth)
+	}
+	return nil
+}
+
+func CreateFeed(ctx context.Context, input FeedInput) (*models.Feed, error) {
 	var existingFeed models.Feed
-	if err := config.DB.Where("url = ?", url).First(&existingFeed).Error; err == nil {
+	if err := config.DB.Where("url = ?", input.URL).First(&existingFeed).Error; err == nil {
 		return nil, errors.New("feed with this URL already exists")
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("database error checking existing feed: %w", err)
 	}
 
-	feed := models.Feed{
-		Name: name,
-		URL: url,
+	feed := models.Feed{URL: input.URL}
+	if err := applyFeedRequestSettings(&feed, input); err != nil {
+		return nil, err
+	}
+
+	// Only URLs that serve a parseable feed are accepted.
+	parsed, err := parseRemoteFeed(ctx, &feed)
+	if err != nil {
+		return nil, err
 	}
 
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = feedNameFromTitle(parsed, input.URL)
+	}
+
+	fetchIntervalMinutes := input.FetchIntervalMinutes
+	if fetchIntervalMinutes <= 0 {
+		fetchIntervalMinutes = DefaultFetchIntervalMinutes
+	}
+
+	feed.Name = name
+	feed.FetchIntervalMinutes = fetchIntervalMinutes
+	feed.FetchFullContent = input.FetchFullContent
+	applyFeedMetadata(&feed, parsed)
+
 	result := config.DB.Create(&feed)
 	if result.Error != nil {
 		return nil, fmt.Errorf("error creating feed: %w", result.Error)
 	}
 
+	// Fetch the new feed right away when this process runs the fetcher. In
+	// serve mode the worker picks it up on its next run since NextFetchAt is unset.
+	if fetcher := runningFeedFetcher(); fetcher != nil {
+		fetcher.Enqueue(feed)
+	}
+
 	return &feed, nil
 }
 
@@ -55,7 +117,7 @@ func GetFeedByID(id uint) (*models.Feed, error) {
 	return &feed, nil
 }
 
-func UpdateFeed(id uint, newName string, newURL string) (*models.Feed, error) {
+func UpdateFeed(ctx context.Context, id uint, input FeedInput) (*models.Feed, error) {
 	var feed models.Feed
 
 	result := config.DB.First(&feed, id)
@@ -69,7 +131,7 @@ func UpdateFeed(id uint, newName string, newURL string) (*models.Feed, error) {
 
 	// Check for duplicate URL (other than this feed)
 	var existingFeedURL models.Feed
-	if err := config.DB.Where("id <> ? AND url = ?", id, newURL).First(&existingFeedURL).Error; err == nil {
+	if err := config.DB.Where("id <> ? AND url = ?", id, input.URL).First(&existingFeedURL).Error; err == nil {
 		// If we found a record, it means a duplicate exists
 		return nil, errors.New("another feed with this URL already exists")
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -77,10 +139,76 @@ func UpdateFeed(id uint, newName string, newURL string) (*models.Feed, error) {
 		return nil, fmt.Errorf("database error checking for duplicate URL: %w", err)
 	}
 
-	feed.Name = newName
-	feed.URL = newURL
+	// A new URL must serve a parseable feed. The current URL is not fetched
+	// again unless its title is needed for the name, so settings of a feed
+	// that is temporarily down can still be changed.
+	if err := applyFeedRequestSettings(&feed, input); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(input.Name)
+	var parsed *gofeed.Feed
+	if input.URL != feed.URL || name == "" {
+		candidate := feed
+		candidate.URL = input.URL
+
+		var err error
+		parsed, err = parseRemoteFeed(ctx, &candidate)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = feedNameFromTitle(parsed, input.URL)
+		}
+	}
+
+	// Only the columns changed here are written: the fetcher may be saving
+	// the fetch state of the feed at the same time, see saveFetchState.
+	columns := []string{"name", "url", "fetch_full_content", "headers", "auth_type", "auth_header_name", "encrypted_credentials"}
+	reschedule := false
+
+	// A new URL gets a fresh start: clear the failure state left by the old
+	// one and take the metadata and favicon of the new feed.
+	if input.URL != feed.URL {
+		columns = append(columns, "title", "description", "site_url", "language", "image_url", "feed_updated_at",
+			"icon_fetched_at", "consecutive_failures", "last_error", "disabled", "disabled_at", "disabled_reason",
+			"redirect_url", "redirect_count", "etag", "last_modified")
+		reschedule = true
+		now := time.Now()
+		feed.URL = input.URL
+		applyFeedMetadata(&feed, parsed)
+		feed.IconFetchedAt = nil
+		feed.ConsecutiveFailures = 0
+		feed.LastError = ""
+		feed.Disabled = false
+		feed.DisabledAt = nil
+		feed.DisabledReason = ""
+		feed.RedirectURL = ""
+		feed.RedirectCount = 0
+		feed.ETag = ""
+		feed.LastModified = ""
+		feed.NextFetchAt = &now
+	}
 
-	result = config.DB.Save(&feed)
+	feed.Name = name
+	feed.URL = input.URL
+	feed.FetchFullContent = input.FetchFullContent
+
+	// A new interval restarts adaptive scheduling from the configured value.
+	if input.FetchIntervalMinutes > 0 && input.FetchIntervalMinutes != feed.FetchIntervalMinutes {
+		columns = append(columns, "fetch_interval_minutes", "adaptive_interval_minutes")
+		reschedule = true
+		now := time.Now()
+		feed.FetchIntervalMinutes = input.FetchIntervalMinutes
+		feed.AdaptiveIntervalMinutes = input.FetchIntervalMinutes
+		feed.NextFetchAt = &now
+	}
+
+	if reschedule {
+		columns = append(columns, "next_fetch_at")
+	}
+
+	result = config.DB.Model(&feed).Select(columns).Updates(&feed)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to update feed: %w", result.Error)
 	}
@@ -99,4 +227,179 @@ func DeleteFeed(id uint) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// GetUnhealthyFeeds returns feeds that failed their last fetch or were
+// disabled, the most broken ones first.
+func GetUnhealthyFeeds() ([]models.Feed, error) {
+	var feeds []models.Feed
+	result := config.DB.Where("consecutive_failures > 0 OR disabled = ?", true).
+		Order("disabled DESC, consecutive_failures DESC, name ASC").
+		Find(&feeds)
+	if result.Error != nil {
+		return nil, fmt.Errorf("error fetching unhealthy feeds: %w", result.Error)
+	}
+	return feeds, nil
+}
+
+// EnableFeed re-enables a disabled feed, resets its failure count and makes
+// it due for fetching right away.
+func EnableFeed(id uint) (*models.Feed, error) {
+	var feed models.Feed
+
+	result := config.DB.First(&feed, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("feed not found")
+		}
+
+		return nil, fmt.Errorf("database error retrieving feed: %w", result.Error)
+	}
+
+	now := time.Now()
+	feed.Disabled = false
+	feed.DisabledAt = nil
+	feed.DisabledReason = ""
+	feed.ConsecutiveFailures = 0
+	feed.NextFetchAt = &now
+
+	// The fetch state stays with the fetcher, see saveFetchState.
+	result = config.DB.Model(&feed).
+		Select("disabled", "disabled_at", "disabled_reason", "consecutive_failures", "next_fetch_at").
+		Updates(&feed)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to enable feed: %w", result.Error)
+	}
+
+	return &feed, nil
+}
+
+// GetFeedFetches returns the most recent fetch history entries of a feed.
+func GetFeedFetches(feedID uint, limit int) ([]models.FeedFetch, error) {
+	var feed models.Feed
+	if err := config.DB.First(&feed, feedID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("feed not found")
+		}
+		return nil, fmt.Errorf("database error retrieving feed: %w", err)
+	}
+
+	var fetches []models.FeedFetch
+	result := config.DB.Where("feed_id = ?", feedID).
+		Order("started_at DESC").
+		Limit(limit).
+		Find(&fetches)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve fetch history: %w", result.Error)
+	}
+
+	return fetches, nil
+}
+
+// GetFeedURLChanges returns the URL history of a feed, newest first.
+func GetFeedURLChanges(feedID uint) ([]models.FeedURLChange, error) {
+	var feed models.Feed
+	if err := config.DB.First(&feed, feedID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("feed not found")
+		}
+		return nil, fmt.Errorf("database error retrieving feed: %w", err)
+	}
+
+	var changes []models.FeedURLChange
+	result := config.DB.Where("feed_id = ?", feedID).Order("created_at DESC").Find(&changes)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retrieve URL history: %w", result.Error)
+	}
+
+	return changes, nil
+}
+
+// FeedRefreshResult summarizes an on-demand refresh of all feeds. Queued
+// feeds are fetched after the refresh call has returned.
+type FeedRefreshResult struct {
+	Feeds   int `json:"feeds"`
+	Queued  int `json:"queued"`
+	Skipped int `json:"skipped"`
+}
+
+// RefreshFeed fetches a single feed right away and returns the number of new
+// articles stored.
+func RefreshFeed(id uint) (int, error) {
+	var feed models.Feed
+
+	result := config.DB.First(&feed, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return 0, errors.New("feed not found")
+		}
+
+		return 0, fmt.Errorf("database error retrieving feed: %w", result.Error)
+	}
+
+	return getFeedFetcher().FetchNow(feed)
+}
+
+// RefreshAllFeeds queues every enabled feed for fetching right away and
+// returns without waiting for the fetches. Where this process runs the
+// fetcher workers the feeds go through their queue, feeds already queued or
+// being fetched are skipped. Elsewhere they are fetched in the background,
+// at most as many at once as the fetcher has workers.
+func RefreshAllFeeds() (*FeedRefreshResult, error) {
+	var feeds []models.Feed
+	if err := config.DB.Where("disabled = ?", false).Find(&feeds).Error; err != nil {
+		return nil, fmt.Errorf("error fetching feeds: %w", err)
+	}
+
+	summary := &FeedRefreshResult{Feeds: len(feeds)}
+
+	if fetcher := runningFeedFetcher(); fetcher != nil {
+		for _, feed := range feeds {
+			if fetcher.Enqueue(feed) {
+				summary.Queued++
+			} else {
+				summary.Skipped++
+			}
+		}
+		return summary, nil
+	}
+
+	summary.Queued = len(feeds)
+	go refreshFeedsInBackground(getFeedFetcher(), feeds)
+	return summary, nil
+}
+
+// refreshFeedsInBackground fetches feeds, at most as many at once as fetcher
+// has workers, and logs the outcome once all are done.
+func refreshFeedsInBackground(fetcher *FeedFetcher, feeds []models.Feed) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var refreshed, failed, skipped, newArticles int
+	slots := make(chan struct{}, fetcher.config.Workers)
+
+	for _, feed := range feeds {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(feed models.Feed) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			count, err := fetcher.FetchNow(feed)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrFeedFetchInProgress), errors.Is(err, ErrFeedFetcherStopped):
+				skipped++
+			case err != nil:
+				failed++
+			default:
+				refreshed++
+				newArticles += count
+			}
+		}(feed)
+	}
+
+	wg.Wait()
+	log.Printf("Refreshed %d feed(s) with %d new article(s), %d failed, %d skipped.", refreshed, newArticles, failed, skipped)
+}
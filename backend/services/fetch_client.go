@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/FarrelioGustiana/backend/config"
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+var (
+	// ErrResponseTooLarge is returned when a response exceeds its size limit.
+	ErrResponseTooLarge = errors.New("response body too large")
+	// ErrInvalidFeedHeaders is returned for custom feed headers that cannot be sent.
+	ErrInvalidFeedHeaders = errors.New("invalid feed headers")
+	// ErrPrivateAddress is returned when a request would connect to an
+	// address that is not publicly routable.
+	ErrPrivateAddress = errors.New("address is not publicly routable")
+)
+
+var (
+	fetchClientOnce sync.Once
+	fetchClient     *http.Client
+	fetchConfig     config.FetchConfig
+)
+
+// reservedFeedHeaders are managed by the fetcher and cannot be overridden by
+// the custom headers of a feed.
+var reservedFeedHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"If-None-Match":     true,
+	"If-Modified-Since": true,
+}
+
+// privateHeadersKey is the context key of the names of the headers of a feed
+// request that must not follow redirects to another host.
+type privateHeadersKey struct{}
+
+// credentialHeaders carry credentials, which are stored encrypted through the
+// auth settings of a feed rather than as plain custom headers.
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// sharedFetchClient returns the HTTP client used for all outgoing requests
+// and the settings it was built from. It is created from the environment on
+// first use; invalid settings stop the process.
+func sharedFetchClient() (*http.Client, config.FetchConfig) {
+	fetchClientOnce.Do(func() {
+		fetchConfig = config.LoadFetchConfig()
+		client, err := newFetchClient(fetchConfig)
+		if err != nil {
+			log.Fatalf("Invalid fetch client configuration: %v", err)
+		}
+		fetchClient = client
+	})
+	return fetchClient, fetchConfig
+}
+
+// newFetchClient builds an HTTP client from cfg. The client follows at most
+// maxRedirects redirects and records permanent ones, see checkRedirect.
+// Unless cfg allows it, it refuses to connect to private addresses.
+func newFetchClient(cfg config.FetchConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.Proxy = http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https") || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", cfg.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if cfg.ConnectTimeout > 0 {
+		dialer.Timeout = cfg.ConnectTimeout
+		transport.TLSHandshakeTimeout = cfg.ConnectTimeout
+	}
+	transport.DialContext = dialer.DialContext
+
+	if !cfg.AllowPrivateAddresses {
+		guarded := *dialer
+		guarded.Control = rejectPrivateAddress
+
+		// The configured proxy may well live on the private network, it is
+		// the only private address requests may connect to.
+		var proxies sync.Map
+		proxy := transport.Proxy
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			proxyURL, err := proxy(req)
+			if proxyURL != nil {
+				proxies.Store(proxyAddr(proxyURL), true)
+			}
+			return proxyURL, err
+		}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if _, ok := proxies.Load(addr); ok {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			return guarded.DialContext(ctx, network, addr)
+		}
+	}
+	if cfg.ReadTimeout > 0 {
+		transport.ResponseHeaderTimeout = cfg.ReadTimeout
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.TLSInsecureSkipVerify}
+	if cfg.TLSMinVersion != "" {
+		version, ok := tlsVersions[cfg.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS version %q", cfg.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+		Timeout:       cfg.ReadTimeout,
+	}, nil
+}
+
+// rejectPrivateAddress is a net.Dialer Control hook refusing connections to
+// loopback, private, link-local and other addresses that are not publicly
+// routable. It runs on the resolved address, so host names pointing at
+// internal services and redirects to them are refused as well.
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is publicly routable.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// proxyAddr returns the host:port the transport dials for proxyURL.
+func proxyAddr(proxyURL *url.URL) string {
+	port := proxyURL.Port()
+	if port == "" {
+		port = "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// newFeedRequest builds a GET request for the URL of feed carrying the
+// configured User-Agent, the custom headers of the feed and its decrypted
+// credentials.
+func newFeedRequest(ctx context.Context, feed *models.Feed) (*http.Request, error) {
+	// The client forwards headers on redirects, checkRedirect removes these
+	// when a redirect leaves the feed's host.
+	private := make([]string, 0, len(feed.Headers)+1)
+	for name := range feed.Headers {
+		private = append(private, name)
+	}
+	if feed.AuthType == models.FeedAuthHeader {
+		private = append(private, feed.AuthHeaderName)
+	}
+	ctx = context.WithValue(ctx, privateHeadersKey{}, private)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	_, cfg := sharedFetchClient()
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	for name, value := range feed.Headers {
+		req.Header.Set(name, value)
+	}
+	if err := applyFeedCredentials(req, feed); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// validateFeedHeaders checks the custom headers of a feed.
+func validateFeedHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		canonical, err := validateFeedHeader(name, value)
+		if err != nil {
+			return err
+		}
+		if credentialHeaders[canonical] {
+			return fmt.Errorf("%w: header %s carries credentials, set them with auth instead", ErrInvalidFeedHeaders, canonical)
+		}
+	}
+	return nil
+}
+
+// validateFeedHeader checks a header sent with the requests of a feed and
+// returns its canonical name.
+func validateFeedHeader(name, value string) (string, error) {
+	canonical := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+	if canonical == "" || strings.ContainsAny(canonical, " \t\r\n:") {
+		return "", fmt.Errorf("%w: invalid header name %q", ErrInvalidFeedHeaders, name)
+	}
+	if reservedFeedHeaders[canonical] {
+		return "", fmt.Errorf("%w: header %s cannot be overridden", ErrInvalidFeedHeaders, canonical)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("%w: invalid value for header %s", ErrInvalidFeedHeaders, canonical)
+	}
+	return canonical, nil
+}
+
+// readLimitedBody reads at most maxBytes from body and fails when it is
+// larger, so an oversized response never ends up half parsed.
+func readLimitedBody(body io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, maxBytes)
+	}
+	return data, nil
+}
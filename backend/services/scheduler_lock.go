@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// schedulerLockKey is the Postgres advisory lock key held by the active
+// feed scheduler. Any constant works as long as every instance uses the same.
+const schedulerLockKey int64 = 7305114101
+
+// feedLockSpace is the first key of the per-feed advisory locks. They use the
+// two key form, whose key space is separate from schedulerLockKey's.
+const feedLockSpace int32 = 7305
+
+// SchedulerLock is a session level Postgres advisory lock that makes sure only
+// one instance runs the feed scheduler. The lock lives as long as the
+// dedicated connection that acquired it.
+type SchedulerLock struct {
+	conn *sql.Conn
+	stop chan struct{}
+}
+
+// AcquireSchedulerLock blocks until this instance holds the scheduler lock,
+// retrying every retryInterval, or until ctx is cancelled.
+func AcquireSchedulerLock(ctx context.Context, db *gorm.DB, retryInterval time.Duration) (*SchedulerLock, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection pool: %w", err)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scheduler lock connection: %w", err)
+	}
+
+	logged := false
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", schedulerLockKey).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to acquire scheduler lock: %w", err)
+		}
+		if acquired {
+			break
+		}
+
+		if !logged {
+			log.Println("Another instance holds the scheduler lock, waiting for it to be released...")
+			logged = true
+		}
+
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+
+	lock := &SchedulerLock{conn: conn, stop: make(chan struct{})}
+	go lock.watch(retryInterval)
+
+	log.Println("Acquired scheduler lock.")
+	return lock, nil
+}
+
+// watch pings the lock connection. Losing it means losing the lock, and
+// another instance may start fetching, so the process exits rather than
+// risk fetching every feed twice.
+func (l *SchedulerLock) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := l.conn.PingContext(ctx)
+			cancel()
+			if err != nil {
+				log.Fatalf("Lost scheduler lock connection: %v", err)
+			}
+		}
+	}
+}
+
+// Release gives up the scheduler lock so another instance can take over.
+func (l *SchedulerLock) Release() {
+	close(l.stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", schedulerLockKey); err != nil {
+		log.Printf("Failed to release scheduler lock: %v", err)
+	}
+	if err := l.conn.Close(); err != nil {
+		log.Printf("Failed to close scheduler lock connection: %v", err)
+	}
+}
+
+// acquireFeedLock takes the advisory lock of a feed, which makes sure no two
+// processes fetch it at the same time: the worker running the scheduler and
+// an API instance serving a refresh, for example. It returns
+// ErrFeedFetchInProgress when another process holds the lock. The lock lives
+// on a dedicated connection until the returned release function is called.
+func acquireFeedLock(ctx context.Context, db *gorm.DB, feedID uint) (func(), error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection pool: %w", err)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feed lock connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)", feedLockSpace, int32(feedID)).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire feed lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, ErrFeedFetchInProgress
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1, $2)", feedLockSpace, int32(feedID)); err != nil {
+			log.Printf("Failed to release lock of feed %d: %v", feedID, err)
+			// A connection that may still hold the lock must not go back
+			// to the pool.
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+const (
+	// storyWindow is how far apart two articles may be published and still
+	// be considered coverage of the same story.
+	storyWindow = 48 * time.Hour
+	// storySimilarityThreshold is the minimum Jaccard similarity of the title
+	// shingles of two articles to put them into the same cluster.
+	storySimilarityThreshold = 0.5
+	// storyCandidateLimit caps how many recent articles a new article is
+	// compared against.
+	storyCandidateLimit = 2000
+)
+
+// titleStopWords are dropped from titles before shingling, they carry no
+// information about the story.
+var titleStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "has": true, "have": true,
+	"in": true, "is": true, "it": true, "its": true, "of": true, "on": true,
+	"or": true, "that": true, "the": true, "to": true, "was": true, "were": true,
+	"will": true, "with": true, "after": true, "over": true, "says": true, "said": true,
+}
+
+// titleShingles returns the set of word unigrams and bigrams of a title,
+// lower-cased and without punctuation and stop words.
+func titleShingles(title string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var kept []string
+	for _, word := range words {
+		if !titleStopWords[word] {
+			kept = append(kept, word)
+		}
+	}
+
+	shingles := make(map[string]bool, len(kept)*2)
+	for i, word := range kept {
+		shingles[word] = true
+		if i > 0 {
+			shingles[kept[i-1]+" "+word] = true
+		}
+	}
+	return shingles
+}
+
+// jaccard returns the Jaccard similarity of two shingle sets.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	intersection := 0
+	for shingle := range a {
+		if b[shingle] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+// assignStoryCluster puts a freshly stored article into the story cluster of
+// the most similar recent article from another feed, creating the cluster if
+// needed. Articles with the same canonical link always end up together.
+func assignStoryCluster(db *gorm.DB, article *models.Article) error {
+	match, err := findStoryMatch(db, article)
+	if err != nil || match == nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Feeds are fetched in parallel, so another article may be joining
+		// match right now. Locking its row makes the second one see the
+		// cluster the first one created instead of creating another.
+		var locked models.Article
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "title", "cluster_id").
+			First(&locked, match.ID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock story match: %w", err)
+		}
+		match = &locked
+
+		clusterID := match.ClusterID
+		if clusterID != nil {
+			// Serializes the stats updates of articles joining the cluster.
+			var cluster models.StoryCluster
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&cluster, *clusterID).Error; err != nil {
+				return fmt.Errorf("failed to lock story cluster: %w", err)
+			}
+		} else {
+			cluster := models.StoryCluster{Title: match.Title}
+			if err := tx.Create(&cluster).Error; err != nil {
+				return fmt.Errorf("failed to create story cluster: %w", err)
+			}
+			clusterID = &cluster.ID
+
+			if err := tx.Model(&models.Article{}).Where("id = ?", match.ID).Update("cluster_id", cluster.ID).Error; err != nil {
+				return fmt.Errorf("failed to add article to story cluster: %w", err)
+			}
+		}
+
+		if err := tx.Model(&models.Article{}).Where("id = ?", article.ID).Update("cluster_id", *clusterID).Error; err != nil {
+			return fmt.Errorf("failed to add article to story cluster: %w", err)
+		}
+		article.ClusterID = clusterID
+
+		return refreshStoryClusterStats(tx, *clusterID)
+	})
+}
+
+// findStoryMatch returns the article that article should be clustered with,
+// or nil when no recent article from another feed is similar enough.
+func findStoryMatch(db *gorm.DB, article *models.Article) (*models.Article, error) {
+	if article.DuplicateOfID != nil {
+		var original models.Article
+		err := db.Select("id", "title", "cluster_id").First(&original, *article.DuplicateOfID).Error
+		if err == nil {
+			return &original, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	shingles := titleShingles(article.Title)
+	if len(shingles) == 0 {
+		return nil, nil
+	}
+
+	published := time.Now()
+	if article.PubDate != nil {
+		published = *article.PubDate
+	}
+
+	var candidates []models.Article
+	err := db.Select("id", "title", "cluster_id").
+		Where("feed_id <> ? AND id <> ?", article.FeedID, article.ID).
+		Where("pub_date BETWEEN ? AND ?", published.Add(-storyWindow), published.Add(storyWindow)).
+		Order("pub_date DESC").
+		Limit(storyCandidateLimit).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var best *models.Article
+	bestScore := storySimilarityThreshold
+	for i := range candidates {
+		score := jaccard(shingles, titleShingles(candidates[i].Title))
+		if score >= bestScore {
+			best = &candidates[i]
+			bestScore = score
+		}
+	}
+	return best, nil
+}
+
+// refreshStoryClusterStats recomputes the counters of a story cluster from
+// its member articles.
+func refreshStoryClusterStats(db *gorm.DB, clusterID uint) error {
+	var stats struct {
+		ArticleCount int
+		SourceCount  int
+		FirstSeenAt  *time.Time
+		LastSeenAt   *time.Time
+	}
+	err := db.Model(&models.Article{}).
+		Select("COUNT(*) AS article_count, COUNT(DISTINCT feed_id) AS source_count, MIN(pub_date) AS first_seen_at, MAX(pub_date) AS last_seen_at").
+		Where("cluster_id = ?", clusterID).
+		Scan(&stats).Error
+	if err != nil {
+		return fmt.Errorf("failed to compute story cluster stats: %w", err)
+	}
+
+	err = db.Model(&models.StoryCluster{}).Where("id = ?", clusterID).Updates(map[string]interface{}{
+		"article_count": stats.ArticleCount,
+		"source_count":  stats.SourceCount,
+		"first_seen_at": stats.FirstSeenAt,
+		"last_seen_at":  stats.LastSeenAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update story cluster stats: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/FarrelioGustiana/backend/config"
+	"github.com/FarrelioGustiana/backend/models"
+)
+
+// Story is a story cluster as seen by one user: only articles from feeds the
+// user subscribes to are counted and listed.
+type Story struct {
+	ID          uint             `json:"id"`
+	Title       string           `json:"title"`
+	SourceCount int              `json:"sourceCount"`
+	LatestAt    *time.Time       `json:"latestAt,omitempty"`
+	Articles    []models.Article `json:"articles"`
+}
+
+// GetStoriesForUser lists the story clusters covered by the user's feeds,
+// ranked by how many of those feeds cover them and then by recency. Only
+// stories covered by at least minSources feeds are returned.
+func GetStoriesForUser(userID string, page, pageSize, minSources int) ([]Story, int64, error) {
+	subscribedFeedIDs, err := getSubscribedFeedIDs(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(subscribedFeedIDs) == 0 {
+		return []Story{}, 0, nil
+	}
+
+	ranked := config.DB.Model(&models.Article{}).
+		Select("cluster_id, COUNT(DISTINCT feed_id) AS source_count, MAX(pub_date) AS latest_at").
+		Where("feed_id IN (?) AND cluster_id IS NOT NULL", subscribedFeedIDs).
+		Group("cluster_id").
+		Having("COUNT(DISTINCT feed_id) >= ?", minSources)
+
+	var totalStories int64
+	if err := config.DB.Table("(?) AS ranked", ranked).Count(&totalStories).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count stories: %w", err)
+	}
+
+	var rows []struct {
+		ClusterID   uint
+		SourceCount int
+		LatestAt    *time.Time
+	}
+	err = ranked.Order("source_count DESC, latest_at DESC, cluster_id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve stories: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return []Story{}, totalStories, nil
+	}
+
+	clusterIDs := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		clusterIDs = append(clusterIDs, row.ClusterID)
+	}
+
+	var clusters []models.StoryCluster
+	if err := config.DB.Where("id IN (?)", clusterIDs).Find(&clusters).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve story clusters: %w", err)
+	}
+	titles := make(map[uint]string, len(clusters))
+	for _, cluster := range clusters {
+		titles[cluster.ID] = cluster.Title
+	}
+
+	var articles []models.Article
+	err = config.DB.Preload("Feed").
+		Where("cluster_id IN (?) AND feed_id IN (?)", clusterIDs, subscribedFeedIDs).
+		Order("pub_date ASC").
+		Find(&articles).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve story articles: %w", err)
+	}
+	members := make(map[uint][]models.Article, len(rows))
+	for _, article := range articles {
+		members[*article.ClusterID] = append(members[*article.ClusterID], article)
+	}
+
+	stories := make([]Story, 0, len(rows))
+	for _, row := range rows {
+		stories = append(stories, Story{
+			ID:          row.ClusterID,
+			Title:       titles[row.ClusterID],
+			SourceCount: row.SourceCount,
+			LatestAt:    row.LatestAt,
+			Articles:    members[row.ClusterID],
+		})
+	}
+
+	return stories, totalStories, nil
+}
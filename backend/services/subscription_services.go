@@ -3,13 +3,14 @@ package services
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/FarrelioGustiana/backend/config"
 	"github.com/FarrelioGustiana/backend/models"
 	"gorm.io/gorm"
 )
 
-func SubscribeToFeed(userID string, feedID uint) (*models.Subscription, error) {
+func SubscribeToFeed(userID string, feedID uint, folder string) (*models.Subscription, error) {
 	// Make sure the user is exist
 	var user models.User
 	if err := config.DB.First(&user, "id = ?", userID).Error; err != nil {
@@ -41,6 +42,7 @@ func SubscribeToFeed(userID string, feedID uint) (*models.Subscription, error) {
 		FeedID: feedID,
 		User: user,
 		Feed: feed,
+		Folder: strings.TrimSpace(folder),
 	}
 	
 	result := config.DB.Create(&subcription)
@@ -51,7 +53,10 @@ func SubscribeToFeed(userID string, feedID uint) (*models.Subscription, error) {
 	return &subcription, nil
 }
 
-func GetUserSubscriptions(userID string) ([]models.Subscription, error) {
+// GetUserSubscriptions returns the subscriptions of userID with their unread
+// counts. collapse counts story clusters once, like the collapsed article
+// list.
+func GetUserSubscriptions(userID string, collapse bool) ([]models.Subscription, error) {
 	var subcriptions []models.Subscription
 
 	result := config.DB.Preload("Feed").Where("user_id = ?", userID).Find(&subcriptions)
@@ -59,6 +64,14 @@ func GetUserSubscriptions(userID string) ([]models.Subscription, error) {
 		return nil, fmt.Errorf("failed to retrieve subscriptions: %w", result.Error)
 	}
 
+	unreadCounts, err := getUnreadCounts(userID, collapse)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subcriptions {
+		subcriptions[i].UnreadCount = unreadCounts[subcriptions[i].FeedID]
+	}
+
 	return subcriptions, nil
 }
 
@@ -76,6 +89,25 @@ func UnsubscribeFromFeed(userID string, feedID uint) error {
 	return nil
 }
 
+// SetSubscriptionFolder moves the subscription of userID to feedID into
+// folder. An empty folder leaves it unfiled.
+func SetSubscriptionFolder(userID string, feedID uint, folder string) (*models.Subscription, error) {
+	var subscription models.Subscription
+	if err := config.DB.Preload("Feed").Where("user_id = ? AND feed_id = ?", userID, feedID).First(&subscription).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("subscription not found")
+		}
+		return nil, fmt.Errorf("database error finding subscription: %w", err)
+	}
+
+	subscription.Folder = strings.TrimSpace(folder)
+	if err := config.DB.Model(&subscription).Update("folder", subscription.Folder).Error; err != nil {
+		return nil, fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	return &subscription, nil
+}
+
 func IsUserSubscribed(userID string, feedID uint) (bool, error) {
 	var count int64
 	err := config.DB.Model(&models.Subscription{}).
@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedTags maps each tag kept by SanitizeHTML to the attributes it may
+// keep. Tags that are neither allowed nor dropped are unwrapped: the tag goes,
+// its children stay.
+var allowedTags = map[string]map[string]bool{
+	"a":          {"href": true, "title": true},
+	"abbr":       {"title": true},
+	"b":          {},
+	"blockquote": {"cite": true},
+	"br":         {},
+	"caption":    {},
+	"cite":       {},
+	"code":       {},
+	"dd":         {},
+	"del":        {},
+	"div":        {},
+	"dl":         {},
+	"dt":         {},
+	"em":         {},
+	"figcaption": {},
+	"figure":     {},
+	"h1":         {},
+	"h2":         {},
+	"h3":         {},
+	"h4":         {},
+	"h5":         {},
+	"h6":         {},
+	"hr":         {},
+	"i":          {},
+	"img":        {"src": true, "alt": true, "title": true, "width": true, "height": true},
+	"ins":        {},
+	"kbd":        {},
+	"li":         {},
+	"mark":       {},
+	"ol":         {"start": true},
+	"p":          {},
+	"pre":        {},
+	"q":          {"cite": true},
+	"s":          {},
+	"small":      {},
+	"span":       {},
+	"strong":     {},
+	"sub":        {},
+	"sup":        {},
+	"table":      {},
+	"tbody":      {},
+	"td":         {"colspan": true, "rowspan": true},
+	"tfoot":      {},
+	"th":         {"colspan": true, "rowspan": true, "scope": true},
+	"thead":      {},
+	"time":       {"datetime": true},
+	"tr":         {},
+	"u":          {},
+	"ul":         {},
+}
+
+// droppedTags are removed together with everything inside them.
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "noscript": true, "template": true,
+	"form": true, "input": true, "button": true, "select": true, "textarea": true,
+	"svg": true, "math": true, "link": true, "meta": true, "base": true,
+	"head": true, "title": true, "audio": true, "video": true,
+}
+
+// urlAttributes are checked for a safe scheme before they are kept.
+var urlAttributes = map[string]bool{"href": true, "src": true, "cite": true}
+
+// blockTags end a line when converting HTML to text.
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "blockquote": true,
+	"pre": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"hr": true, "table": true, "ul": true, "ol": true, "dl": true, "dt": true, "dd": true,
+	"figure": true, "figcaption": true, "section": true, "article": true,
+}
+
+var (
+	blankLines    = regexp.MustCompile(`\n\s*\n+`)
+	inlineSpacing = regexp.MustCompile(`[ \t\r\f\v]+`)
+)
+
+// SanitizeHTML makes untrusted HTML from a feed safe to render. Only an
+// allowlist of tags and attributes is kept, scripts, styles, frames and
+// embedded objects are removed with their content, event handlers and
+// javascript: style URLs are dropped, and links open in a new tab with
+// rel="noopener noreferrer nofollow".
+func SanitizeHTML(input string) string {
+	if strings.TrimSpace(input) == "" {
+		return ""
+	}
+
+	nodes, err := html.ParseFragment(strings.NewReader(input), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return html.EscapeString(input)
+	}
+
+	var b strings.Builder
+	for _, node := range nodes {
+		writeSanitized(&b, node)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func writeSanitized(b *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(node.Data))
+		return
+	case html.ElementNode:
+	default:
+		// Comments, doctypes and the like are dropped.
+		return
+	}
+
+	tag := strings.ToLower(node.Data)
+	if droppedTags[tag] {
+		return
+	}
+
+	allowedAttrs, allowed := allowedTags[tag]
+	if !allowed {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			writeSanitized(b, child)
+		}
+		return
+	}
+
+	if tag == "img" && safeURL(attrValue(node, "src")) == "" {
+		return
+	}
+
+	b.WriteString("<" + tag)
+	for _, attr := range node.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || !allowedAttrs[key] {
+			continue
+		}
+		value := attr.Val
+		if urlAttributes[key] {
+			value = safeURL(value)
+			if value == "" {
+				continue
+			}
+		}
+		b.WriteString(" " + key + `="` + html.EscapeString(value) + `"`)
+	}
+	if tag == "a" {
+		b.WriteString(` target="_blank" rel="noopener noreferrer nofollow"`)
+	}
+	b.WriteString(">")
+
+	if tag == "br" || tag == "hr" || tag == "img" {
+		return
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeSanitized(b, child)
+	}
+	b.WriteString("</" + tag + ">")
+}
+
+// safeURL returns rawURL when it is relative or uses http, https or mailto,
+// and an empty string otherwise.
+func safeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "", "http", "https", "mailto":
+		return rawURL
+	default:
+		return ""
+	}
+}
+
+func attrValue(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, key) {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// HTMLToText returns the readable text of an HTML fragment, with block
+// elements on their own lines and whitespace collapsed.
+func HTMLToText(input string) string {
+	if strings.TrimSpace(input) == "" {
+		return ""
+	}
+
+	nodes, err := html.ParseFragment(strings.NewReader(input), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return strings.TrimSpace(input)
+	}
+
+	var b strings.Builder
+	for _, node := range nodes {
+		writeText(&b, node)
+	}
+
+	text := inlineSpacing.ReplaceAllString(b.String(), " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+func writeText(b *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		b.WriteString(strings.ReplaceAll(node.Data, "\n", " "))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	tag := strings.ToLower(node.Data)
+	if droppedTags[tag] {
+		return
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeText(b, child)
+	}
+	if blockTags[tag] {
+		b.WriteString("\n")
+	}
+}
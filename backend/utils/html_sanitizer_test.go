@@ -0,0 +1,202 @@
+package utils
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "empty",
+			input: "  \n ",
+			want:  "",
+		},
+		{
+			name:  "allowed markup is kept",
+			input: `<p>Hello <strong>world</strong>, <em>again</em></p>`,
+			want:  `<p>Hello <strong>world</strong>, <em>again</em></p>`,
+		},
+		{
+			name:  "script is dropped with its content",
+			input: `<p>Hi</p><script>alert(1)</script>`,
+			want:  `<p>Hi</p>`,
+		},
+		{
+			name:  "style is dropped with its content",
+			input: `<style>body{display:none}</style><p>Hi</p>`,
+			want:  `<p>Hi</p>`,
+		},
+		{
+			name:  "event handlers are removed",
+			input: `<p onclick="alert(1)" onmouseover="alert(2)">Hi</p><img src="/a.png" onerror="alert(3)">`,
+			want:  `<p>Hi</p><img src="/a.png">`,
+		},
+		{
+			name:  "style and class attributes are removed",
+			input: `<span style="color:red" class="x" id="y">Hi</span>`,
+			want:  `<span>Hi</span>`,
+		},
+		{
+			name:  "javascript link",
+			input: `<a href="javascript:alert(1)">click</a>`,
+			want:  `<a target="_blank" rel="noopener noreferrer nofollow">click</a>`,
+		},
+		{
+			name:  "mixed case javascript link",
+			input: `<a href=" JaVaScRiPt:alert(1)">click</a>`,
+			want:  `<a target="_blank" rel="noopener noreferrer nofollow">click</a>`,
+		},
+		{
+			name:  "entity encoded javascript link",
+			input: `<a href="&#106;avascript:alert(1)">click</a>`,
+			want:  `<a target="_blank" rel="noopener noreferrer nofollow">click</a>`,
+		},
+		{
+			name:  "javascript link with embedded tab",
+			input: "<a href=\"java\tscript:alert(1)\">click</a>",
+			want:  `<a target="_blank" rel="noopener noreferrer nofollow">click</a>`,
+		},
+		{
+			name:  "vbscript link",
+			input: `<a href="vbscript:msgbox(1)">click</a>`,
+			want:  `<a target="_blank" rel="noopener noreferrer nofollow">click</a>`,
+		},
+		{
+			name:  "data URL image is dropped",
+			input: `<img src="data:image/svg+xml;base64,PHN2Zy8+" alt="x">`,
+			want:  ``,
+		},
+		{
+			name:  "data URL link",
+			input: `<a href="data:text/html,<script>alert(1)</script>">click</a>`,
+			want:  `<a target="_blank" rel="noopener noreferrer nofollow">click</a>`,
+		},
+		{
+			name:  "safe links are kept",
+			input: `<a href="https://example.com/a?b=1&c=2" title="T">x</a> <a href="mailto:me@example.com">m</a> <a href="/relative">r</a>`,
+			want:  `<a href="https://example.com/a?b=1&amp;c=2" title="T" target="_blank" rel="noopener noreferrer nofollow">x</a> <a href="mailto:me@example.com" target="_blank" rel="noopener noreferrer nofollow">m</a> <a href="/relative" target="_blank" rel="noopener noreferrer nofollow">r</a>`,
+		},
+		{
+			name:  "rel and target from the feed are replaced",
+			input: `<a href="https://example.com" target="_self" rel="opener">x</a>`,
+			want:  `<a href="https://example.com" target="_blank" rel="noopener noreferrer nofollow">x</a>`,
+		},
+		{
+			name:  "svg is dropped with its content",
+			input: `<svg><script>alert(1)</script><a xlink:href="javascript:alert(2)">x</a></svg><p>after</p>`,
+			want:  `<p>after</p>`,
+		},
+		{
+			name:  "svg style mutation",
+			input: `<svg></p><style><a id="</style><img src=1 onerror=alert(1)>">`,
+			want:  ``,
+		},
+		{
+			name:  "math mutation",
+			input: `<math><mtext><table><mglyph><style><img src=x onerror=alert(1)></style></mglyph></table></mtext></math>`,
+			want:  ``,
+		},
+		{
+			name:  "noscript mutation",
+			input: `<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+			want:  `<img src="x">&#34;&gt;`,
+		},
+		{
+			name:  "frames and objects are dropped",
+			input: `<iframe src="https://evil.example"></iframe><object data="x.swf"></object><embed src="x.swf"><p>ok</p>`,
+			want:  `<p>ok</p>`,
+		},
+		{
+			name:  "forms are dropped",
+			input: `<form action="https://evil.example"><input name="password"><button>Go</button></form><p>ok</p>`,
+			want:  `<p>ok</p>`,
+		},
+		{
+			name:  "unknown tags are unwrapped",
+			input: `<section><custom-tag>Hello</custom-tag> <font color="red">world</font></section>`,
+			want:  `Hello world`,
+		},
+		{
+			name:  "comments are dropped",
+			input: `<p>a<!-- <script>alert(1)</script> -->b</p>`,
+			want:  `<p>ab</p>`,
+		},
+		{
+			name:  "entities are escaped once",
+			input: `<p>Fish &amp; chips &lt;3 &quot;quoted&quot; &copy; 2024</p>`,
+			want:  `<p>Fish &amp; chips &lt;3 &#34;quoted&#34; © 2024</p>`,
+		},
+		{
+			name:  "escaped markup stays text",
+			input: `&lt;script&gt;alert(1)&lt;/script&gt;`,
+			want:  `&lt;script&gt;alert(1)&lt;/script&gt;`,
+		},
+		{
+			name:  "attribute values are escaped",
+			input: `<img src="/a.png" alt="&quot; onerror=&quot;alert(1)">`,
+			want:  `<img src="/a.png" alt="&#34; onerror=&#34;alert(1)">`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeHTML(tt.input); got != tt.want {
+				t.Errorf("SanitizeHTML(%q)\n got: %s\nwant: %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  "",
+		},
+		{
+			name:  "plain text",
+			input: "Just a title",
+			want:  "Just a title",
+		},
+		{
+			name:  "entities are decoded",
+			input: `Fish &amp; chips &lt;3 &quot;quoted&quot; &#8212; &copy;`,
+			want:  `Fish & chips <3 "quoted" — ©`,
+		},
+		{
+			name:  "block elements end lines",
+			input: `<h1>Title</h1><p>First   paragraph</p><p>Second<br>line</p>`,
+			want:  "Title\nFirst paragraph\nSecond\nline",
+		},
+		{
+			name:  "scripts and styles are left out",
+			input: `<p>Hi</p><script>alert(1)</script><style>p{}</style><noscript>Enable JS</noscript>`,
+			want:  "Hi",
+		},
+		{
+			name:  "inline elements keep their text",
+			input: `<p>Read <a href="/x">the <b>full</b> story</a>.</p>`,
+			want:  "Read the full story.",
+		},
+		{
+			name:  "blank lines are collapsed",
+			input: "<div>a</div>\n\n\n<div></div><div>b</div>",
+			want:  "a\n\nb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.input); got != tt.want {
+				t.Errorf("HTMLToText(%q)\n got: %q\nwant: %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// secretPrefix marks the format of values produced by EncryptSecret, so the
+// scheme can change later without guessing.
+const secretPrefix = "v1:"
+
+// EncryptSecret encrypts plaintext with AES-GCM under key, which must be 16,
+// 24 or 32 bytes long. The result holds a random nonce and is safe to store
+// as text.
+func EncryptSecret(key []byte, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret. It fails when the value was
+// encrypted under another key or has been tampered with.
+func DecryptSecret(key []byte, encoded string) ([]byte, error) {
+	if !strings.HasPrefix(encoded, secretPrefix) {
+		return nil, errors.New("unknown secret format")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, secretPrefix))
+	if err != nil {
+		return nil, errors.New("malformed secret")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("malformed secret")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt secret")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestEncryptSecretRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       []byte
+		plaintext []byte
+	}{
+		{name: "AES-128", key: bytes.Repeat([]byte{1}, 16), plaintext: []byte("hunter2")},
+		{name: "AES-192", key: bytes.Repeat([]byte{2}, 24), plaintext: []byte(`{"username":"reader","password":"s3cret"}`)},
+		{name: "AES-256", key: bytes.Repeat([]byte{3}, 32), plaintext: []byte("token with unicode ✓")},
+		{name: "empty plaintext", key: bytes.Repeat([]byte{4}, 32), plaintext: []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := EncryptSecret(tt.key, tt.plaintext)
+			if err != nil {
+				t.Fatalf("EncryptSecret: %v", err)
+			}
+			if !strings.HasPrefix(encoded, secretPrefix) {
+				t.Errorf("encrypted value %q lacks the %q prefix", encoded, secretPrefix)
+			}
+			if len(tt.plaintext) > 0 && strings.Contains(encoded, string(tt.plaintext)) {
+				t.Errorf("encrypted value %q contains the plaintext", encoded)
+			}
+
+			decrypted, err := DecryptSecret(tt.key, encoded)
+			if err != nil {
+				t.Fatalf("DecryptSecret: %v", err)
+			}
+			if !bytes.Equal(decrypted, tt.plaintext) {
+				t.Errorf("DecryptSecret = %q, want %q", decrypted, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptSecretUsesRandomNonces(t *testing.T) {
+	key := bytes.Repeat([]byte{5}, 32)
+	first, err := EncryptSecret(key, []byte("same secret"))
+	if err != nil {
+		t.Fatalf("EncryptSecret: %v", err)
+	}
+	second, err := EncryptSecret(key, []byte("same secret"))
+	if err != nil {
+		t.Fatalf("EncryptSecret: %v", err)
+	}
+	if first == second {
+		t.Errorf("encrypting the same secret twice gave the same value %q", first)
+	}
+}
+
+func TestEncryptSecretRejectsInvalidKeys(t *testing.T) {
+	for _, size := range []int{0, 15, 31, 33} {
+		if _, err := EncryptSecret(make([]byte, size), []byte("secret")); err == nil {
+			t.Errorf("EncryptSecret with a %d byte key succeeded", size)
+		}
+	}
+}
+
+func TestDecryptSecretFailures(t *testing.T) {
+	key := bytes.Repeat([]byte{6}, 32)
+	encoded, err := EncryptSecret(key, []byte("a secret long enough to truncate"))
+	if err != nil {
+		t.Fatalf("EncryptSecret: %v", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, secretPrefix))
+	if err != nil {
+		t.Fatalf("failed to decode encrypted value: %v", err)
+	}
+	reencode := func(data []byte) string {
+		return secretPrefix + base64.StdEncoding.EncodeToString(data)
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 0x01
+
+	tests := []struct {
+		name    string
+		key     []byte
+		encoded string
+	}{
+		{name: "wrong key", key: bytes.Repeat([]byte{7}, 32), encoded: encoded},
+		{name: "key of another size", key: bytes.Repeat([]byte{6}, 16), encoded: encoded},
+		{name: "invalid key", key: []byte("short"), encoded: encoded},
+		{name: "truncated ciphertext", key: key, encoded: reencode(sealed[:len(sealed)-5])},
+		{name: "truncated to the nonce", key: key, encoded: reencode(sealed[:12])},
+		{name: "shorter than the nonce", key: key, encoded: reencode(sealed[:5])},
+		{name: "empty", key: key, encoded: secretPrefix},
+		{name: "tampered ciphertext", key: key, encoded: reencode(tampered)},
+		{name: "missing prefix", key: key, encoded: strings.TrimPrefix(encoded, secretPrefix)},
+		{name: "unknown version", key: key, encoded: "v2:" + strings.TrimPrefix(encoded, secretPrefix)},
+		{name: "not base64", key: key, encoded: secretPrefix + "not base64!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if plaintext, err := DecryptSecret(tt.key, tt.encoded); err == nil {
+				t.Fatalf("DecryptSecret succeeded with %q", plaintext)
+			}
+		})
+	}
+}
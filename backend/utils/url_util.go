@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// trackingParams are query parameters that only carry campaign or click
+// tracking data and never change which page a URL points to.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"igshid":  true,
+	"ref_src": true,
+}
+
+// CanonicalizeURL normalizes an article URL so that links to the same page
+// compare equal. It lower-cases the scheme and host, drops default ports, the
+// fragment, utm_* and other tracking parameters, sorts the remaining query
+// parameters by name and removes trailing slashes from the path. Strings that do not
+// parse as absolute URLs are returned trimmed but otherwise unchanged.
+func CanonicalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return rawURL
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	port := parsed.Port()
+	if (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	parsed.Host = host
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	query := parsed.Query()
+	for key := range query {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			query.Del(key)
+		}
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var encoded []string
+	for _, key := range keys {
+		// The values of a repeated key keep their order, which may matter.
+		for _, value := range query[key] {
+			encoded = append(encoded, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	parsed.RawQuery = strings.Join(encoded, "&")
+	parsed.ForceQuery = false
+
+	// The trailing slash is trimmed from the escaped path, so escaped
+	// slashes like the one in /a%2Fb are kept.
+	if len(parsed.Path) > 1 {
+		escaped := strings.TrimRight(parsed.EscapedPath(), "/")
+		if escaped == "" {
+			escaped = "/"
+		}
+		if path, err := url.PathUnescape(escaped); err == nil {
+			parsed.Path = path
+			parsed.RawPath = escaped
+		}
+	}
+
+	return parsed.String()
+}
@@ -0,0 +1,150 @@
+package utils
+
+import "testing"
+
+func TestCanonicalizeURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "already canonical",
+			input: "https://example.com/news/story",
+			want:  "https://example.com/news/story",
+		},
+		{
+			name:  "surrounding whitespace",
+			input: "  https://example.com/story \n",
+			want:  "https://example.com/story",
+		},
+		{
+			name:  "scheme and host are lower-cased",
+			input: "HTTPS://Example.COM/Story",
+			want:  "https://example.com/Story",
+		},
+		{
+			name:  "utm parameters are stripped",
+			input: "https://example.com/story?utm_source=rss&utm_medium=feed&UTM_Campaign=x&id=7",
+			want:  "https://example.com/story?id=7",
+		},
+		{
+			name:  "click ids are stripped",
+			input: "https://example.com/story?fbclid=abc&gclid=def&page=2",
+			want:  "https://example.com/story?page=2",
+		},
+		{
+			name:  "only tracking parameters",
+			input: "https://example.com/story?fbclid=abc",
+			want:  "https://example.com/story",
+		},
+		{
+			name:  "fragment is removed",
+			input: "https://example.com/story#comments",
+			want:  "https://example.com/story",
+		},
+		{
+			name:  "default https port is dropped",
+			input: "https://example.com:443/story",
+			want:  "https://example.com/story",
+		},
+		{
+			name:  "default http port is dropped",
+			input: "http://example.com:80/story",
+			want:  "http://example.com/story",
+		},
+		{
+			name:  "other ports are kept",
+			input: "https://example.com:8443/story",
+			want:  "https://example.com:8443/story",
+		},
+		{
+			name:  "port of the other scheme is kept",
+			input: "http://example.com:443/story",
+			want:  "http://example.com:443/story",
+		},
+		{
+			name:  "trailing slash is removed",
+			input: "https://example.com/news/story/",
+			want:  "https://example.com/news/story",
+		},
+		{
+			name:  "repeated trailing slashes are removed",
+			input: "https://example.com/news/story//",
+			want:  "https://example.com/news/story",
+		},
+		{
+			name:  "root path is kept",
+			input: "https://example.com/",
+			want:  "https://example.com/",
+		},
+		{
+			name:  "double slash root path",
+			input: "https://example.com//",
+			want:  "https://example.com/",
+		},
+		{
+			name:  "double slashes inside the path are kept",
+			input: "https://example.com/a//b",
+			want:  "https://example.com/a//b",
+		},
+		{
+			name:  "escaped slash stays escaped",
+			input: "https://example.com/a%2Fb/",
+			want:  "https://example.com/a%2Fb",
+		},
+		{
+			name:  "escaped characters are kept",
+			input: "https://example.com/caf%C3%A9/a%20b",
+			want:  "https://example.com/caf%C3%A9/a%20b",
+		},
+		{
+			name:  "query parameters are sorted by name",
+			input: "https://example.com/story?b=2&a=1&c=3",
+			want:  "https://example.com/story?a=1&b=2&c=3",
+		},
+		{
+			name:  "values of a repeated parameter keep their order",
+			input: "https://example.com/story?tag=z&id=1&tag=a",
+			want:  "https://example.com/story?id=1&tag=z&tag=a",
+		},
+		{
+			name:  "empty query is dropped",
+			input: "https://example.com/story?",
+			want:  "https://example.com/story",
+		},
+		{
+			name:  "relative URL is returned as is",
+			input: "/news/story/",
+			want:  "/news/story/",
+		},
+		{
+			name:  "unparseable URL is returned as is",
+			input: "http://exa mple.com/%zz",
+			want:  "http://exa mple.com/%zz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanonicalizeURL(tt.input); got != tt.want {
+				t.Errorf("CanonicalizeURL(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeURLKeepsDistinctURLsApart(t *testing.T) {
+	pairs := [][2]string{
+		{"https://example.com/a%2Fb", "https://example.com/a/b"},
+		{"https://example.com/story?tag=a&tag=b", "https://example.com/story?tag=b&tag=a"},
+		{"https://example.com/story?id=1", "https://example.com/story?id=2"},
+		{"http://example.com/story", "https://example.com/story"},
+	}
+
+	for _, pair := range pairs {
+		if CanonicalizeURL(pair[0]) == CanonicalizeURL(pair[1]) {
+			t.Errorf("%q and %q canonicalize to the same URL %q", pair[0], pair[1], CanonicalizeURL(pair[0]))
+		}
+	}
+}